@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS consecutive_failures;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS consecutive_failures;
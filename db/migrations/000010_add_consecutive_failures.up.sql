@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS Repository ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS AlertFingerprint;
+DROP TABLE IF EXISTS AlertLog;
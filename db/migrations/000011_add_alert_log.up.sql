@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS AlertLog (
+  id SERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  url TEXT NOT NULL,
+  body TEXT NOT NULL DEFAULT '',
+  link TEXT NOT NULL DEFAULT '',
+  suppressed BOOLEAN NOT NULL DEFAULT false,
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS AlertFingerprint (
+  id SERIAL PRIMARY KEY,
+  target TEXT NOT NULL,
+  fingerprint TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS alert_fingerprint_target ON AlertFingerprint (target, id);
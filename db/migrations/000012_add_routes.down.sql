@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS Route;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS tags;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS tags;
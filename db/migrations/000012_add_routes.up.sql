@@ -0,0 +1,13 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Repository ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS Route (
+  id SERIAL PRIMARY KEY,
+  target_type TEXT NOT NULL DEFAULT '',
+  target_id INTEGER NOT NULL DEFAULT 0,
+  url_pattern TEXT NOT NULL DEFAULT '',
+  tag TEXT NOT NULL DEFAULT '',
+  destinations TEXT NOT NULL,
+  severity TEXT NOT NULL DEFAULT 'info',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
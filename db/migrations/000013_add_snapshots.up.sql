@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS Snapshot (
+  id SERIAL PRIMARY KEY,
+  endpoint_id INTEGER NOT NULL REFERENCES Endpoint (id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  diff_id TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS snapshot_endpoint ON Snapshot (endpoint_id, id);
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS last_run_at;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS next_run_at;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS last_run_at;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS next_run_at;
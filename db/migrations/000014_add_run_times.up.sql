@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN last_run_at TIMESTAMPTZ;
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN next_run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE IF EXISTS Repository ADD COLUMN last_run_at TIMESTAMPTZ;
+ALTER TABLE IF EXISTS Repository ADD COLUMN next_run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS schedule_cron;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS timezone;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS schedule_cron;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN schedule_cron TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Repository ADD COLUMN schedule_cron TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Repository ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS Run (
+  id SERIAL PRIMARY KEY,
+  target_type TEXT NOT NULL,
+  target_id INTEGER NOT NULL DEFAULT 0,
+  url TEXT NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL,
+  finished_at TIMESTAMPTZ NOT NULL,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  commit_range TEXT NOT NULL DEFAULT '',
+  bytes INTEGER NOT NULL DEFAULT 0,
+  lines INTEGER NOT NULL DEFAULT 0,
+  diff BOOLEAN NOT NULL DEFAULT false,
+  alerted BOOLEAN NOT NULL DEFAULT false,
+  stage TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS run_started_at ON Run (started_at);
+CREATE INDEX IF NOT EXISTS run_target ON Run (target_type, target_id, started_at);
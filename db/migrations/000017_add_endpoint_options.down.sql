@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS options;
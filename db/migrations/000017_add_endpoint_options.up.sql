@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN options JSONB NOT NULL DEFAULT '{}';
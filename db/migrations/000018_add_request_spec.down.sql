@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS method;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS headers;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS request_body;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS cookies;
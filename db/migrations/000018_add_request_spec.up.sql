@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN method TEXT NOT NULL DEFAULT 'GET';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN headers JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN request_body TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN cookies JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS auth_username;
+ALTER TABLE IF EXISTS Repository DROP COLUMN IF EXISTS auth_secret;
+
+DROP TABLE IF EXISTS Secret;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS Secret (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  value BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  rotated_at TIMESTAMPTZ
+);
+
+ALTER TABLE IF EXISTS Repository ADD COLUMN auth_username TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Repository ADD COLUMN auth_secret TEXT NOT NULL DEFAULT '';
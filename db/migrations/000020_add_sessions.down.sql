@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS session;
+
+DROP TABLE IF EXISTS Session;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS Session (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  steps JSONB NOT NULL DEFAULT '[]',
+  logged_out_pattern TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN session TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS timeout_seconds;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS final_url;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS redirects;
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN timeout_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN final_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN redirects TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS etag;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS last_modified;
+ALTER TABLE IF EXISTS Endpoint DROP COLUMN IF EXISTS content_hash;
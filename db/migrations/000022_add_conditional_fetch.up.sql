@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS Endpoint ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
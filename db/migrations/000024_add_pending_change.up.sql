@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS PendingChange (
+  target TEXT PRIMARY KEY,
+  fingerprint TEXT NOT NULL,
+  runs INTEGER NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -5,9 +5,17 @@ import (
 	"log"
 	monitor2 "monitor2/src"
 	"monitor2/src/alerts"
+	"monitor2/src/commands"
+	"monitor2/src/crawler"
 	database "monitor2/src/db"
+	"monitor2/src/secrets"
+	"monitor2/src/sessions"
+	"monitor2/src/workers"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -51,12 +59,98 @@ func main() {
 		log.Fatalf("API_PORT is not an integer: %+v", err)
 	}
 
+	err = secrets.Init()
+	if err != nil {
+		log.Fatalf("Could not load secrets key: %+v", err)
+	}
+
+	err = crawler.SealStoredCredentials(&database.DB)
+	if err != nil {
+		log.Printf("Could not seal stored credentials: %+v", err)
+	}
+
+	err = sessions.SealStoredSessions(&database.DB)
+	if err != nil {
+		log.Printf("Could not seal stored session steps: %+v", err)
+	}
+
 	alerts.Init()
+	workers.Init()
+	crawler.InitFetch()
+
+	err = commands.Init()
+	if err != nil {
+		log.Printf("Could not register discord commands: %+v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// not derived from ctx, running jobs keep going until the shutdown deadline
+	jobs_ctx, cancel_jobs := context.WithCancel(context.Background())
+	defer cancel_jobs()
 
 	addr := "0.0.0.0" + ":" + port
-	go app.Init(addr)
+	app.Jobs = jobs_ctx
+	// the server exists before a signal can shut it down
+	app.Init(addr)
+	go app.Serve()
+
+	scheduler_done := make(chan struct{})
+	go func() {
+		monitor2.StartScheduler(ctx, jobs_ctx)
+		close(scheduler_done)
+	}()
+
+	<-ctx.Done()
+	// a second signal kills the process right away
+	stop()
+	shutdown(scheduler_done, cancel_jobs)
+}
+
+// shutdown stops dispatching jobs and waits for the running ones,
+// and the http requests, up to SHUTDOWN_TIMEOUT_SECONDS.
+// Jobs still running then are cancelled, the db is closed once they returned.
+func shutdown(scheduler_done chan struct{}, cancel_jobs context.CancelFunc) {
+	timeout := 30 * time.Second
+	if raw := os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Printf("Invalid SHUTDOWN_TIMEOUT_SECONDS: %s", raw)
+		} else {
+			timeout = time.Duration(seconds) * time.Second
+		}
+	}
+
+	log.Printf("Shutting down, waiting up to %s for running jobs", timeout)
+	workers.Default.Close()
+
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := app.Shutdown(shutdown_ctx)
+	if err != nil {
+		log.Printf("Could not shutdown the server: %+v", err)
+	}
+
+	select {
+	case <-scheduler_done:
+	case <-shutdown_ctx.Done():
+		log.Printf("Running jobs didn't finish in %s, cancelling them", timeout)
+		cancel_jobs()
+		// cancelled jobs still record their failure
+		<-scheduler_done
+	}
+
+	err = alerts.Drain()
+	if err != nil {
+		log.Printf("Could not send buffered alerts: %+v", err)
+	}
+
+	err = alerts.Close()
+	if err != nil {
+		log.Printf("Could not close discord: %+v", err)
+	}
 
-	done := make(chan bool)
-	go monitor2.StartScheduler()
-	<-done
+	database.DB.Pool.Close()
 }
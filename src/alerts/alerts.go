@@ -1,81 +1,346 @@
 package alerts
 
-// package main
-
 import (
+	"errors"
+	"fmt"
 	"log"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
 	"os"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Source string
+
+const (
+	SourceCrawler    Source = "crawler"
+	SourceRepository Source = "repository"
+)
+
+type Kind string
 
-	"github.com/bwmarrin/discordgo"
+const (
+	KindDiff       Kind = "diff"
+	KindStatusCode Kind = "status_code"
+	KindRedirect   Kind = "redirect"
+	KindError      Kind = "error"
 )
 
-type Discord struct {
-	discord_envs map[string]string
-	sess         *discordgo.Session
+// Event is a single change detected on an endpoint or repository.
+// Notifiers decide how to render it.
+type Event struct {
+	Source        Source
+	Kind          Kind
+	TargetId      int
+	Tags          []string
+	Url           string
+	Body          string
+	Link          string
+	DiffId        string
+	OldStatusCode int
+	NewStatusCode int
+	Time          time.Time
+
+	// set for KindRedirect, Body has the redirect chain
+	OldLocation string
+	NewLocation string
+
+	// set for KindError
+	Stage    string
+	Error    string
+	Failures int
+
+	// set by routing rules, empty means the notifier's default channel
+	Channel  string
+	Severity string
 }
 
-var discord Discord
+// Message renders the event the way it was historically posted to discord.
+func (e Event) Message() string {
+	if e.Severity != "" && e.Severity != SeverityInfo {
+		return "[" + e.Severity + "] " + e.message()
+	}
+	return e.message()
+}
 
-func Init() {
-	var discord_envs = make(map[string]string)
+func (e Event) message() string {
+	switch e.Kind {
+	case KindStatusCode:
+		return fmt.Sprintf("endpoint: %s\nstatus code has changed: \nprevious: %+v\nnew: %+v\n", e.Url, e.OldStatusCode, e.NewStatusCode)
+	case KindRedirect:
+		return fmt.Sprintf("endpoint: %s\nredirect target has changed: \nprevious: %s\nnew: %s\n", e.Url, e.OldLocation, e.NewLocation)
+	case KindError:
+		return fmt.Sprintf("%s: %s\nstage: %s\nconsecutive failures: %d\nerror: %s\n", e.Source, e.Url, e.Stage, e.Failures, e.Error)
+	}
 
-	envs := []string{
-		"DISCORD_TOKEN",
-		"APPLICATION_ID",
-		"GUILD_ID",
-		"CHANNEL_ID",
-		"MONITOR_THREAD",
-		"ERROR_THREAD",
+	if e.Source == SourceRepository {
+		return fmt.Sprintf("repo: %s\n%s", e.Url, e.Link)
 	}
 
-	missing := []string{}
-	for _, env := range envs {
-		v := os.Getenv(env)
+	return e.Url
+}
+
+type Notifier interface {
+	Name() string
+	Notify(event Event) error
+}
+
+// Flusher is implemented by notifiers that buffer events, e.g. digests.
+type Flusher interface {
+	Flush() error
+}
+
+// Drainer is implemented by notifiers that may hold events back, e.g. digests or retries,
+// Drain sends everything before the process exits.
+type Drainer interface {
+	Drain() error
+}
+
+// Factory builds a notifier from the environment.
+// It returns a nil Notifier when the backend is not configured.
+type Factory func() (Notifier, error)
+
+var (
+	factories = map[string]Factory{}
+	notifiers = []Notifier{}
+	mu        sync.RWMutex
+
+	// record stores every alert, sent or suppressed, for the /alerts page.
+	record func(alert models.AlertLog) error
+)
 
-		if len(v) == 0 {
-			missing = append(missing, env)
-		} else {
-			discord_envs[env] = v
+// RegisterFactory makes a backend available to Init.
+// Backends call it from their own init().
+func RegisterFactory(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Register adds an already built notifier.
+func Register(notifier Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	notifiers = append(notifiers, notifier)
+}
+
+// Reset removes every registered notifier.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	notifiers = []Notifier{}
+}
+
+func Notifiers() []Notifier {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Notifier{}, notifiers...)
+}
+
+func Init() {
+	for name, factory := range factories {
+		notifier, err := factory()
+		if err != nil {
+			log.Fatalf("Could not configure %s notifier: %+v", name, err)
 		}
+
+		if notifier == nil {
+			continue
+		}
+
+		log.Printf("Notifier enabled: %s", name)
+		Register(notifier)
 	}
 
-	if len(missing) != 0 {
-		log.Fatalf("Error missing the following env variables: %+v\n", missing)
+	if len(Notifiers()) == 0 {
+		log.Printf("No notifiers configured, alerts will only be logged")
 	}
 
-	sess, err := discordgo.New("Bot" + " " + discord_envs["DISCORD_TOKEN"])
+	history, err := intFromEnv("ALERT_DEDUP_HISTORY", 0)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	discord = Discord{
-		sess:         sess,
-		discord_envs: discord_envs,
+	persist, err := intFromEnv("ALERT_PERSIST_RUNS", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	SetDedup(NewDedup(
+		history,
+		persist,
+		func(target string, n int) ([]string, error) {
+			return database.DB.GetRecentFingerprints(target, n)
+		},
+		func(target string, fingerprint string, keep int) error {
+			return database.DB.CreateFingerprint(target, fingerprint, keep)
+		},
+	).StorePending(
+		func(target string, fingerprint string) (int, error) {
+			return database.DB.CountPendingChange(target, fingerprint)
+		},
+		func(target string) error {
+			return database.DB.DeletePendingChange(target)
+		},
+	))
+
+	record = func(alert models.AlertLog) error {
+		return database.DB.CreateAlertLog(alert)
+	}
+
+	routes = func() ([]models.Route, error) {
+		return database.DB.GetAllRoutes()
 	}
 }
 
-func Alert(message string, file_contents string, filetype string) error {
-	var msg_send discordgo.MessageSend = discordgo.MessageSend{
-    Content: message,
-  }
+func intFromEnv(env string, fallback int) (int, error) {
+	raw := os.Getenv(env)
+	if len(raw) == 0 {
+		return fallback, nil
+	}
 
-	reader := strings.NewReader(file_contents)
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not an integer: %w", env, err)
+	}
+	return v, nil
+}
 
-	file := discordgo.File{
-		Name:        filetype,
-		ContentType: "text/plain",
-		Reader:      reader,
+// Alert sends the event to every registered notifier.
+// A failing notifier doesn't stop the others.
+func Alert(event Event) error {
+	var errs []error
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	deliveries, err := resolve(event)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, d := range deliveries {
+		err := d.notifier.Notify(d.event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.notifier.Name(), err))
+		}
+	}
+
+	store(event, false, "")
+
+	return errors.Join(errs...)
+}
+
+// Suppress records an event without sending it.
+func Suppress(event Event, reason string) {
+	log.Printf("Alert suppressed for %s: %s", event.Url, reason)
+	store(event, true, reason)
+}
+
+func store(event Event, suppressed bool, reason string) {
+	if record == nil {
+		return
+	}
+
+	body := event.Body
+	if event.Kind == KindError {
+		body = event.Error
+	}
+
+	err := record(models.AlertLog{
+		Source:     string(event.Source),
+		Kind:       string(event.Kind),
+		Url:        event.Url,
+		Body:       body,
+		Link:       event.Link,
+		Suppressed: suppressed,
+		Reason:     reason,
+	})
+	if err != nil {
+		log.Printf("Could not record alert: %+v", err)
+	}
+}
+
+// Flush is called by the scheduler at the end of every cycle.
+func Flush() error {
+	var errs []error
+
+	for _, notifier := range Notifiers() {
+		flusher, ok := notifier.(Flusher)
+		if !ok {
+			continue
+		}
+
+		err := flusher.Flush()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Drain sends every buffered event regardless of digest periods.
+func Drain() error {
+	var errs []error
+
+	for _, notifier := range Notifiers() {
+		var err error
+		switch n := notifier.(type) {
+		case Drainer:
+			err = n.Drain()
+		case Flusher:
+			err = n.Flush()
+		default:
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+		}
 	}
 
-	msg_send.File = &file
+	return errors.Join(errs...)
+}
 
-	_, err := discord.sess.ChannelMessageSendComplex(
-		discord.discord_envs["MONITOR_THREAD"],
-		&msg_send,
-	)
+// StageError tags an error with the step of a run that failed.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func Stage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+// StageOf splits err into the stage that failed, "unknown" without one, and its message.
+func StageOf(err error) (string, string) {
+	var stage_err *StageError
+	if errors.As(err, &stage_err) {
+		return stage_err.Stage, stage_err.Err.Error()
+	}
+	return "unknown", err.Error()
+}
 
-  if err != nil { return err }
+// Failure reports a failed run of target to the error channel of its notifiers.
+func Failure(target Event, err error, failures int) error {
+	stage, message := StageOf(err)
 
-  return nil
+	target.Kind = KindError
+	target.Stage = stage
+	target.Error = message
+	target.Failures = failures
+	return Alert(target)
 }
@@ -0,0 +1,87 @@
+package alerts_test
+
+import (
+	"errors"
+	"monitor2/src/alerts"
+	"testing"
+)
+
+type fakeNotifier struct {
+	name   string
+	err    error
+	events []alerts.Event
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Notify(event alerts.Event) error {
+	f.events = append(f.events, event)
+	return f.err
+}
+
+func TestAlertWithoutNotifiers(t *testing.T) {
+	alerts.Reset()
+
+	err := alerts.Alert(alerts.Event{Url: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlertFansOut(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+
+	broken := &fakeNotifier{name: "broken", err: errors.New("boom")}
+	working := &fakeNotifier{name: "working"}
+	alerts.Register(broken)
+	alerts.Register(working)
+
+	err := alerts.Alert(alerts.Event{
+		Source: alerts.SourceCrawler,
+		Kind:   alerts.KindDiff,
+		Url:    "https://example.com",
+		Body:   "+a\n",
+	})
+	if err == nil {
+		t.Fatal("expected error from broken notifier")
+	}
+
+	if len(working.events) != 1 || working.events[0].Body != "+a\n" {
+		t.Fatal(working.events)
+	}
+}
+
+func TestEventMessage(t *testing.T) {
+	event := alerts.Event{
+		Source:        alerts.SourceCrawler,
+		Kind:          alerts.KindStatusCode,
+		Url:           "https://example.com",
+		OldStatusCode: 200,
+		NewStatusCode: 404,
+	}
+
+	correct := "endpoint: https://example.com\nstatus code has changed: \nprevious: 200\nnew: 404\n"
+	if event.Message() != correct {
+		t.Fatal(event.Message())
+	}
+}
+
+func TestFailureCarriesStage(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+
+	notifier := &fakeNotifier{name: "fake"}
+	alerts.Register(notifier)
+
+	target := alerts.Event{Source: alerts.SourceCrawler, Url: "https://example.com"}
+	err := alerts.Failure(target, alerts.Stage("fetch", errors.New("connection reset")), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := notifier.events[0]
+	if event.Kind != alerts.KindError || event.Stage != "fetch" || event.Error != "connection reset" || event.Failures != 3 {
+		t.Fatal(event)
+	}
+}
@@ -0,0 +1,180 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+)
+
+// Verdict tells the crawler what to do with a detected change.
+// Pending means the change hasn't persisted long enough yet,
+// the caller should keep its previous content as the baseline.
+type Verdict struct {
+	Suppress bool
+	Pending  bool
+	Reason   string
+}
+
+type pending_change struct {
+	fingerprint string
+	runs        int
+}
+
+// Dedup remembers the last `history` content fingerprints of every target
+// and suppresses changes back to one of them, e.g. rotating A/B tests.
+// With persist > 1 a change has to be seen on that many consecutive runs
+// before it is alerted. The runs are counted by `count` when it is set so
+// they survive restarts and are shared between replicas, in memory otherwise.
+type Dedup struct {
+	history  int
+	persist  int
+	recent   func(target string, n int) ([]string, error)
+	remember func(target string, fingerprint string, keep int) error
+	count    func(target string, fingerprint string) (int, error)
+	clear    func(target string) error
+
+	mu      sync.Mutex
+	pending map[string]pending_change
+}
+
+var dedup = NewDedup(0, 1, nil, nil)
+
+func NewDedup(
+	history int,
+	persist int,
+	recent func(target string, n int) ([]string, error),
+	remember func(target string, fingerprint string, keep int) error,
+) *Dedup {
+	return &Dedup{
+		history:  history,
+		persist:  persist,
+		recent:   recent,
+		remember: remember,
+		pending:  map[string]pending_change{},
+	}
+}
+
+// StorePending makes d count pending changes with count and reset them with clear.
+func (d *Dedup) StorePending(
+	count func(target string, fingerprint string) (int, error),
+	clear func(target string) error,
+) *Dedup {
+	d.count = count
+	d.clear = clear
+	return d
+}
+
+// Fingerprint hashes the extracted lines of a target.
+// Against a fixed baseline it identifies the same added and removed line sets.
+func Fingerprint(lines [][]byte) string {
+	sum := sha256.Sum256(bytes.Join(lines, []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Check decides whether the change from previous to current should be alerted.
+// Storage errors are logged and the change is alerted.
+func (d *Dedup) Check(target string, previous string, current string) Verdict {
+	if d.persist > 1 {
+		runs := d.runs(target, current)
+		if runs < d.persist {
+			return Verdict{
+				Pending: true,
+				Reason:  fmt.Sprintf("change seen on %d of %d consecutive runs", runs, d.persist),
+			}
+		}
+
+		d.reset(target)
+	}
+
+	if d.history <= 0 || d.recent == nil || d.remember == nil {
+		return Verdict{}
+	}
+
+	seen, err := d.recent(target, d.history)
+	if err != nil {
+		log.Printf("Could not load fingerprints for %s: %+v", target, err)
+		return Verdict{}
+	}
+
+	if !slices.Contains(seen, previous) {
+		d.store(target, previous)
+	}
+	d.store(target, current)
+
+	if slices.Contains(seen, current) {
+		return Verdict{
+			Suppress: true,
+			Reason:   fmt.Sprintf("content matches a state seen in the last %d snapshots", d.history),
+		}
+	}
+
+	return Verdict{}
+}
+
+// Unchanged resets the persistence counter of target,
+// a change has to be seen on consecutive runs.
+func (d *Dedup) Unchanged(target string) {
+	if d.persist > 1 {
+		d.reset(target)
+	}
+}
+
+// runs counts the consecutive runs current was seen for target,
+// falling back to the in-memory counter when it can't be stored.
+func (d *Dedup) runs(target string, current string) int {
+	if d.count != nil {
+		runs, err := d.count(target, current)
+		if err == nil {
+			return runs
+		}
+		log.Printf("Could not count pending change for %s: %+v", target, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	change := d.pending[target]
+	if change.fingerprint == current {
+		change.runs++
+	} else {
+		change = pending_change{fingerprint: current, runs: 1}
+	}
+	d.pending[target] = change
+	return change.runs
+}
+
+func (d *Dedup) reset(target string) {
+	d.mu.Lock()
+	delete(d.pending, target)
+	d.mu.Unlock()
+
+	if d.clear == nil {
+		return
+	}
+	err := d.clear(target)
+	if err != nil {
+		log.Printf("Could not reset pending change for %s: %+v", target, err)
+	}
+}
+
+func (d *Dedup) store(target string, fingerprint string) {
+	err := d.remember(target, fingerprint, d.history)
+	if err != nil {
+		log.Printf("Could not store fingerprint for %s: %+v", target, err)
+	}
+}
+
+func SetDedup(d *Dedup) {
+	dedup = d
+}
+
+func Check(target string, previous string, current string) Verdict {
+	return dedup.Check(target, previous, current)
+}
+
+func Unchanged(target string) {
+	dedup.Unchanged(target)
+}
@@ -0,0 +1,111 @@
+package alerts_test
+
+import (
+	"monitor2/src/alerts"
+	"testing"
+)
+
+type fingerprints map[string][]string
+
+func (f fingerprints) recent(target string, n int) ([]string, error) {
+	seen := f[target]
+	if len(seen) > n {
+		seen = seen[len(seen)-n:]
+	}
+	return append([]string{}, seen...), nil
+}
+
+func (f fingerprints) remember(target string, fingerprint string, keep int) error {
+	f[target] = append(f[target], fingerprint)
+	return nil
+}
+
+func TestDedupSuppressesFlaps(t *testing.T) {
+	store := fingerprints{}
+	dedup := alerts.NewDedup(5, 1, store.recent, store.remember)
+
+	if v := dedup.Check("e", "A", "B"); v.Suppress {
+		t.Fatal("first change suppressed")
+	}
+
+	if v := dedup.Check("e", "B", "A"); !v.Suppress {
+		t.Fatal("flap back to A not suppressed")
+	}
+
+	if v := dedup.Check("e", "A", "B"); !v.Suppress {
+		t.Fatal("flap back to B not suppressed")
+	}
+
+	if v := dedup.Check("e", "B", "C"); v.Suppress {
+		t.Fatal("new content suppressed")
+	}
+}
+
+func TestDedupRequiresPersistence(t *testing.T) {
+	dedup := alerts.NewDedup(0, 2, nil, nil)
+
+	if v := dedup.Check("e", "A", "B"); !v.Pending {
+		t.Fatal("change alerted on first run")
+	}
+
+	if v := dedup.Check("e", "A", "B"); v.Pending || v.Suppress {
+		t.Fatal("persisted change not alerted")
+	}
+
+	dedup.Check("e", "B", "C")
+	dedup.Unchanged("e")
+	if v := dedup.Check("e", "B", "C"); !v.Pending {
+		t.Fatal("counter not reset by an unchanged run")
+	}
+}
+
+type pendingChange struct {
+	fingerprint string
+	runs        int
+}
+
+type pendingChanges map[string]pendingChange
+
+func (p pendingChanges) count(target string, fingerprint string) (int, error) {
+	change := p[target]
+	if change.fingerprint == fingerprint {
+		change.runs++
+	} else {
+		change = pendingChange{fingerprint, 1}
+	}
+	p[target] = change
+	return change.runs, nil
+}
+
+func (p pendingChanges) clear(target string) error {
+	delete(p, target)
+	return nil
+}
+
+func TestDedupStoresPendingChanges(t *testing.T) {
+	store := pendingChanges{}
+
+	// every run on a fresh replica
+	check := func(previous string, current string) alerts.Verdict {
+		return alerts.NewDedup(0, 3, nil, nil).StorePending(store.count, store.clear).Check("e", previous, current)
+	}
+
+	if v := check("A", "B"); !v.Pending {
+		t.Fatal("change alerted on first run")
+	}
+	if v := check("A", "B"); !v.Pending {
+		t.Fatal("change alerted on second run")
+	}
+	if v := check("A", "B"); v.Pending || v.Suppress {
+		t.Fatal("change stored across replicas not alerted")
+	}
+	if _, ok := store["e"]; ok {
+		t.Fatal("pending change kept after the alert")
+	}
+
+	check("B", "C")
+	alerts.NewDedup(0, 3, nil, nil).StorePending(store.count, store.clear).Unchanged("e")
+	if _, ok := store["e"]; ok {
+		t.Fatal("pending change kept after an unchanged run")
+	}
+}
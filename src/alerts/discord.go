@@ -0,0 +1,152 @@
+package alerts
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type Discord struct {
+	discord_envs map[string]string
+	sess         *discordgo.Session
+}
+
+func init() {
+	RegisterFactory("discord", discordFromEnv)
+}
+
+func discordFromEnv() (Notifier, error) {
+	var discord_envs = make(map[string]string)
+
+	if len(os.Getenv("DISCORD_TOKEN")) == 0 {
+		return nil, nil
+	}
+
+	envs := []string{
+		"DISCORD_TOKEN",
+		"APPLICATION_ID",
+		"GUILD_ID",
+		"CHANNEL_ID",
+		"MONITOR_THREAD",
+		"ERROR_THREAD",
+	}
+
+	missing := []string{}
+	for _, env := range envs {
+		v := os.Getenv(env)
+
+		if len(v) == 0 {
+			missing = append(missing, env)
+		} else {
+			discord_envs[env] = v
+		}
+	}
+
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("Error missing the following env variables: %+v", missing)
+	}
+
+	sess, err := discordgo.New("Bot" + " " + discord_envs["DISCORD_TOKEN"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discord{
+		sess:         sess,
+		discord_envs: discord_envs,
+	}, nil
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) Notify(event Event) error {
+	var msg_send discordgo.MessageSend = discordgo.MessageSend{
+		Content: event.Message(),
+	}
+
+	if event.Kind == KindError {
+		_, err := d.sess.ChannelMessageSendComplex(
+			d.discord_envs["ERROR_THREAD"],
+			&msg_send,
+		)
+		return err
+	}
+
+	filetype := "basic"
+	if event.Kind == KindDiff {
+		filetype = "diff"
+	}
+
+	reader := strings.NewReader(event.Body)
+
+	file := discordgo.File{
+		Name:        filetype,
+		ContentType: "text/plain",
+		Reader:      reader,
+	}
+
+	msg_send.File = &file
+
+	channel := d.discord_envs["MONITOR_THREAD"]
+	if len(event.Channel) != 0 {
+		channel = event.Channel
+	}
+
+	_, err := d.sess.ChannelMessageSendComplex(
+		channel,
+		&msg_send,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RegisterCommands replaces the guild slash commands of the bot with commands
+// and sends every interaction to handler. It's a no-op without a discord notifier.
+func RegisterCommands(commands []*discordgo.ApplicationCommand, handler func(s *discordgo.Session, i *discordgo.InteractionCreate)) error {
+	var d *Discord
+	for _, notifier := range Notifiers() {
+		if discord, ok := notifier.(*Discord); ok {
+			d = discord
+		}
+	}
+
+	if d == nil {
+		return nil
+	}
+
+	d.sess.AddHandler(handler)
+
+	err := d.sess.Open()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.sess.ApplicationCommandBulkOverwrite(
+		d.discord_envs["APPLICATION_ID"],
+		d.discord_envs["GUILD_ID"],
+		commands,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close disconnects the bot from the gateway if RegisterCommands opened it.
+func Close() error {
+	for _, notifier := range Notifiers() {
+		if discord, ok := notifier.(*Discord); ok {
+			return discord.sess.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package alerts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"monitor2/utils"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EmailImmediate = "immediate"
+	EmailDigest    = "digest"
+)
+
+type SendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// Email sends one mail per event, or in digest mode buffers events
+// until Flush is called and the digest period has elapsed.
+// A period of 0 sends the digest on every Flush, i.e. once per scheduler cycle.
+// Error events are sent right away to error_to when it is set.
+type Email struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	to       []string
+	error_to []string
+	mode     string
+	period   time.Duration
+	send     SendMail
+
+	mu         sync.Mutex
+	pending    []Event
+	last_flush time.Time
+}
+
+func init() {
+	RegisterFactory("email", emailFromEnv)
+}
+
+func emailFromEnv() (Notifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if len(host) == 0 {
+		return nil, nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if len(port) == 0 {
+		port = "25"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if len(from) == 0 {
+		return nil, errors.New("SMTP_FROM is empty")
+	}
+
+	to := utils.SplitList(os.Getenv("SMTP_TO"))
+	if len(to) == 0 {
+		return nil, errors.New("SMTP_TO is empty")
+	}
+
+	mode := os.Getenv("SMTP_MODE")
+	if len(mode) == 0 {
+		mode = EmailImmediate
+	}
+	if mode != EmailImmediate && mode != EmailDigest {
+		return nil, fmt.Errorf("SMTP_MODE must be %s or %s", EmailImmediate, EmailDigest)
+	}
+
+	var period time.Duration = 24 * time.Hour
+	if raw := os.Getenv("SMTP_DIGEST_PERIOD"); len(raw) != 0 {
+		if raw == "cycle" {
+			period = 0
+		} else {
+			p, err := time.ParseDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("SMTP_DIGEST_PERIOD: %w", err)
+			}
+			period = p
+		}
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); len(username) != 0 {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	email := NewEmail(host+":"+port, auth, from, to, mode, period)
+	email.error_to = utils.SplitList(os.Getenv("SMTP_ERROR_TO"))
+	return email, nil
+}
+
+func NewEmail(addr string, auth smtp.Auth, from string, to []string, mode string, period time.Duration) *Email {
+	return &Email{
+		addr:       addr,
+		auth:       auth,
+		from:       from,
+		to:         to,
+		mode:       mode,
+		period:     period,
+		send:       smtp.SendMail,
+		last_flush: time.Now(),
+	}
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+func (e *Email) Notify(event Event) error {
+	if event.Kind == KindError && len(e.error_to) != 0 {
+		return e.deliver(e.error_to, subjectFor(event), []Event{event})
+	}
+
+	if e.mode == EmailDigest {
+		e.mu.Lock()
+		e.pending = append(e.pending, event)
+		e.mu.Unlock()
+		return nil
+	}
+
+	return e.deliver(e.recipients(event.Channel), subjectFor(event), []Event{event})
+}
+
+// recipients of a routed event, channel is an address when set.
+func (e *Email) recipients(channel string) []string {
+	if len(channel) != 0 {
+		return []string{channel}
+	}
+	return e.to
+}
+
+// Flush sends the buffered digest once the period has elapsed.
+func (e *Email) Flush() error {
+	return e.flush(false)
+}
+
+// Drain sends the buffered digest right away, used on shutdown.
+func (e *Email) Drain() error {
+	return e.flush(true)
+}
+
+func (e *Email) flush(force bool) error {
+	e.mu.Lock()
+	if len(e.pending) == 0 || (!force && time.Since(e.last_flush) < e.period) {
+		e.mu.Unlock()
+		return nil
+	}
+
+	events := e.pending
+	e.pending = nil
+	e.last_flush = time.Now()
+	e.mu.Unlock()
+
+	// one digest per recipient list
+	var channels []string
+	grouped := map[string][]Event{}
+	for _, event := range events {
+		if _, ok := grouped[event.Channel]; !ok {
+			channels = append(channels, event.Channel)
+		}
+		grouped[event.Channel] = append(grouped[event.Channel], event)
+	}
+
+	var errs []error
+	var failed []Event
+	for _, channel := range channels {
+		group := grouped[channel]
+		subject := fmt.Sprintf("[monitor2] %d change(s)", len(group))
+		err := e.deliver(e.recipients(channel), subject, group)
+		if err != nil {
+			errs = append(errs, err)
+			failed = append(failed, group...)
+		}
+	}
+
+	if len(failed) != 0 {
+		// keep them for the next flush
+		e.mu.Lock()
+		e.pending = append(failed, e.pending...)
+		e.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *Email) deliver(to []string, subject string, events []Event) error {
+	msg, err := buildEmail(e.from, to, subject, events)
+	if err != nil {
+		return err
+	}
+
+	return e.send(e.addr, e.auth, e.from, to, msg)
+}
+
+func subjectFor(event Event) string {
+	if event.Severity != "" && event.Severity != SeverityInfo {
+		return strings.Replace(subject(event), "[monitor2]", "[monitor2]["+event.Severity+"]", 1)
+	}
+	return subject(event)
+}
+
+func subject(event Event) string {
+	switch {
+	case event.Kind == KindError:
+		return fmt.Sprintf("[monitor2] %s failing at %s: %s", event.Source, event.Stage, event.Url)
+	case event.Kind == KindStatusCode:
+		return fmt.Sprintf("[monitor2] status code changed: %s", event.Url)
+	case event.Kind == KindRedirect:
+		return fmt.Sprintf("[monitor2] redirect target changed: %s", event.Url)
+	case event.Source == SourceRepository:
+		return fmt.Sprintf("[monitor2] repository changed: %s", event.Url)
+	}
+	return fmt.Sprintf("[monitor2] endpoint changed: %s", event.Url)
+}
+
+var emailHtml = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+  <body>
+    {{ range . }}
+    <h3>{{ .Url }}</h3>
+    <p>{{ .Source }} - {{ .Kind }} - {{ .Time.Format "2006-01-02 15:04" }}</p>
+    {{ if eq .Kind "status_code" }}<p>previous: {{ .OldStatusCode }}<br>new: {{ .NewStatusCode }}</p>{{ end }}
+    {{ if eq .Kind "redirect" }}<p>previous: {{ .OldLocation }}<br>new: {{ .NewLocation }}</p>{{ end }}
+    {{ if eq .Kind "error" }}<p>stage: {{ .Stage }}<br>consecutive failures: {{ .Failures }}</p><pre>{{ .Error }}</pre>{{ end }}
+    {{ if .Link }}<p><a href="{{ .Link }}">{{ .Link }}</a></p>{{ end }}
+    {{ if .Body }}<pre>{{ .Body }}</pre>{{ end }}
+    <hr>
+    {{ end }}
+  </body>
+</html>
+`))
+
+func buildEmail(from string, to []string, subject string, events []Event) ([]byte, error) {
+	var text bytes.Buffer
+	for _, event := range events {
+		fmt.Fprintf(&text, "%s\n%s - %s - %s\n", event.Url, event.Source, event.Kind, event.Time.Format("2006-01-02 15:04"))
+		if event.Kind == KindStatusCode {
+			fmt.Fprintf(&text, "previous: %d\nnew: %d\n", event.OldStatusCode, event.NewStatusCode)
+		}
+		if event.Kind == KindRedirect {
+			fmt.Fprintf(&text, "previous: %s\nnew: %s\n", event.OldLocation, event.NewLocation)
+		}
+		if event.Kind == KindError {
+			fmt.Fprintf(&text, "stage: %s\nconsecutive failures: %d\n%s\n", event.Stage, event.Failures, event.Error)
+		}
+		if len(event.Link) != 0 {
+			fmt.Fprintf(&text, "%s\n", event.Link)
+		}
+		if len(event.Body) != 0 {
+			fmt.Fprintf(&text, "\n%s\n", event.Body)
+		}
+		text.WriteString("\n----------\n\n")
+	}
+
+	var html bytes.Buffer
+	err := emailHtml.Execute(&html, events)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		content_type string
+		content      []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.content_type},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(part.content)
+		if err != nil {
+			return nil, err
+		}
+		qp.Close()
+	}
+	writer.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
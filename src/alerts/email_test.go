@@ -0,0 +1,93 @@
+package alerts_test
+
+import (
+	"monitor2/src/alerts"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type outbox struct {
+	mails []string
+}
+
+func (o *outbox) send(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	o.mails = append(o.mails, string(msg))
+	return nil
+}
+
+func TestEmailImmediate(t *testing.T) {
+	box := &outbox{}
+	email := alerts.NewTestEmail(alerts.EmailImmediate, 0, box.send)
+
+	err := email.Notify(alerts.Event{Url: "https://example.com", Kind: alerts.KindDiff, Body: "+a\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(box.mails) != 1 {
+		t.Fatal(box.mails)
+	}
+
+	if !strings.Contains(box.mails[0], "text/html") || !strings.Contains(box.mails[0], "text/plain") {
+		t.Fatal(box.mails[0])
+	}
+}
+
+func TestEmailDigestGroupsEvents(t *testing.T) {
+	box := &outbox{}
+	email := alerts.NewTestEmail(alerts.EmailDigest, 0, box.send)
+
+	email.Notify(alerts.Event{Url: "https://example.com/a", Kind: alerts.KindDiff, Body: "+a\n"})
+	email.Notify(alerts.Event{Url: "https://example.com/b", Kind: alerts.KindDiff, Body: "+b\n"})
+
+	if len(box.mails) != 0 {
+		t.Fatal("digest sent before flush")
+	}
+
+	err := email.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(box.mails) != 1 {
+		t.Fatal(box.mails)
+	}
+
+	if !strings.Contains(box.mails[0], "example.com/a") || !strings.Contains(box.mails[0], "example.com/b") {
+		t.Fatal(box.mails[0])
+	}
+
+	email.Flush()
+	if len(box.mails) != 1 {
+		t.Fatal("empty digest sent")
+	}
+}
+
+func TestEmailDigestWaitsForPeriod(t *testing.T) {
+	box := &outbox{}
+	email := alerts.NewTestEmail(alerts.EmailDigest, 24*time.Hour, box.send)
+
+	email.Notify(alerts.Event{Url: "https://example.com/a", Kind: alerts.KindDiff})
+	email.Flush()
+
+	if len(box.mails) != 0 {
+		t.Fatal("digest sent before the period elapsed")
+	}
+}
+
+func TestEmailDrainIgnoresPeriod(t *testing.T) {
+	box := &outbox{}
+	email := alerts.NewTestEmail(alerts.EmailDigest, 24*time.Hour, box.send)
+
+	email.Notify(alerts.Event{Url: "https://example.com/a", Kind: alerts.KindDiff})
+	err := email.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(box.mails) != 1 {
+		t.Fatal(box.mails)
+	}
+}
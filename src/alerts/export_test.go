@@ -0,0 +1,26 @@
+package alerts
+
+import (
+	"monitor2/src/db/models"
+	"time"
+)
+
+func NewTestWebhook(url string, secret string, retries int, record func(models.WebhookDelivery) error) *Webhook {
+	webhook := NewWebhook(url, secret)
+	webhook.retries = retries
+	webhook.backoff = time.Millisecond
+	webhook.record = record
+	return webhook
+}
+
+func NewTestEmail(mode string, period time.Duration, send SendMail) *Email {
+	email := NewEmail("localhost:1025", nil, "monitor2@localhost", []string{"team@localhost"}, mode, period)
+	email.send = send
+	return email
+}
+
+func SetRoutes(fn func() ([]models.Route, error)) {
+	routes = fn
+}
+
+var LocalPath = localPath
@@ -0,0 +1,179 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func Alerts(w http.ResponseWriter, r *http.Request) {
+	suppressed := false
+	if raw := r.FormValue("suppressed"); raw != "" {
+		var err error
+		suppressed, err = strconv.ParseBool(raw)
+		if err != nil {
+			fmt.Fprint(w, "Invalid suppressed value")
+			return
+		}
+	}
+
+	alerts, err := database.DB.GetAlertLogs(suppressed, 500)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/alerts.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "alerts.html", alerts)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+func Routes(w http.ResponseWriter, r *http.Request) {
+	routes, err := database.DB.GetAllRoutes()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/routes.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "routes.html", map[string]any{
+		"Routes":      routes,
+		"Severities":  Severities,
+		"TargetTypes": TargetTypes,
+	})
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+func routeFromForm(r *http.Request) (models.Route, error) {
+	var err error
+
+	target_id := 0
+	if raw := r.PostFormValue("target_id"); raw != "" {
+		target_id, err = strconv.Atoi(raw)
+		if err != nil {
+			return models.Route{}, errors.New("Invalid target_id value")
+		}
+	}
+
+	severity := r.PostFormValue("severity")
+	if len(severity) == 0 {
+		severity = SeverityInfo
+	}
+
+	route := models.Route{
+		TargetType:   r.PostFormValue("target_type"),
+		TargetId:     target_id,
+		UrlPattern:   r.PostFormValue("url_pattern"),
+		Tag:          r.PostFormValue("tag"),
+		Destinations: r.PostFormValue("destinations"),
+		Severity:     severity,
+	}
+
+	err = ValidateRoute(route)
+	if err != nil {
+		return models.Route{}, err
+	}
+
+	return route, nil
+}
+
+// redirectBack sends the browser to the page the form was posted from.
+func redirectBack(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, localPath(r.PostFormValue("redirect"), "/routes"), 303)
+}
+
+// localPath returns back when it's a path on this site, fallback otherwise.
+// Browsers read a backslash as a slash and drop tabs and newlines, so /\evil.com is //evil.com.
+func localPath(back string, fallback string) string {
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.Contains(back, "\\") {
+		return fallback
+	}
+
+	u, err := url.Parse(back)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return fallback
+	}
+	return back
+}
+
+func CreateRoute(w http.ResponseWriter, r *http.Request) {
+	route, err := routeFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = database.DB.CreateRoute(route)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	redirectBack(w, r)
+}
+
+func UpdateRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		fmt.Fprint(w, "Invalid id value")
+		return
+	}
+
+	route, err := routeFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+	route.Id = id
+
+	err = database.DB.UpdateRoute(route)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	redirectBack(w, r)
+}
+
+func DeleteRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		fmt.Fprint(w, "Invalid id value")
+		return
+	}
+
+	rows_affected, err := database.DB.DeleteRoute(id)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if r.PostFormValue("redirect") != "" {
+		redirectBack(w, r)
+		return
+	}
+
+	fmt.Fprintf(w, "Rows affected: %+v\n", rows_affected)
+}
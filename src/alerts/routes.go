@@ -0,0 +1,185 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"monitor2/src/db/models"
+	"monitor2/utils"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+var TargetTypes = []string{"endpoint", "repository"}
+
+// routes loads the routing rules, nil sends everything everywhere.
+var routes func() ([]models.Route, error)
+
+type delivery struct {
+	notifier Notifier
+	event    Event
+}
+
+// A destination is "<notifier>" or "<notifier>:<channel>",
+// e.g. "discord:1234567890", "email:alice@example.com" or "slack:https://hooks.slack.com/...".
+type destination struct {
+	notifier string
+	channel  string
+}
+
+func parseDestinations(s string) []destination {
+	ret := []destination{}
+	for _, item := range utils.SplitList(s) {
+		name, channel, _ := strings.Cut(item, ":")
+		ret = append(ret, destination{
+			notifier: strings.TrimSpace(name),
+			channel:  strings.TrimSpace(channel),
+		})
+	}
+	return ret
+}
+
+func TargetType(source Source) string {
+	if source == SourceRepository {
+		return "repository"
+	}
+	return "endpoint"
+}
+
+func Matches(route models.Route, event Event) bool {
+	if route.TargetType != "" && route.TargetType != TargetType(event.Source) {
+		return false
+	}
+
+	if route.TargetId != 0 && route.TargetId != event.TargetId {
+		return false
+	}
+
+	if route.UrlPattern != "" {
+		matched, err := regexp.MatchString(route.UrlPattern, event.Url)
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	if route.Tag != "" && !slices.Contains(event.Tags, route.Tag) {
+		return false
+	}
+
+	return true
+}
+
+func RoutesFor(all []models.Route, event Event) []models.Route {
+	ret := []models.Route{}
+	for _, route := range all {
+		if Matches(route, event) {
+			ret = append(ret, route)
+		}
+	}
+	return ret
+}
+
+func ValidateRoute(route models.Route) error {
+	if route.TargetType != "" && !slices.Contains(TargetTypes, route.TargetType) {
+		return fmt.Errorf("target_type must be one of: %s", strings.Join(TargetTypes, ", "))
+	}
+
+	// endpoint and repository ids overlap
+	if route.TargetId != 0 && route.TargetType == "" {
+		return errors.New("target_id needs a target_type")
+	}
+
+	if !slices.Contains(Severities, route.Severity) {
+		return fmt.Errorf("severity must be one of: %s", strings.Join(Severities, ", "))
+	}
+
+	if route.UrlPattern != "" {
+		_, err := regexp.Compile(route.UrlPattern)
+		if err != nil {
+			return fmt.Errorf("invalid url_pattern: %w", err)
+		}
+	}
+
+	destinations := parseDestinations(route.Destinations)
+	if len(destinations) == 0 {
+		return errors.New("destinations can't be empty")
+	}
+
+	for _, d := range destinations {
+		if _, ok := factories[d.notifier]; !ok {
+			return fmt.Errorf("unknown notifier: %s", d.notifier)
+		}
+	}
+
+	return nil
+}
+
+// resolve returns where event has to be sent.
+// Without a matching route it goes to every notifier on its default channel,
+// so does it when the routes can't be loaded, e.g. failure alerts during a db outage,
+// or when none of the destinations of the matched routes is configured.
+func resolve(event Event) ([]delivery, error) {
+	all := Notifiers()
+
+	var matched []models.Route
+	if routes != nil {
+		rules, err := routes()
+		if err != nil {
+			log.Printf("Could not load alert routes, sending to every notifier: %+v", err)
+		} else {
+			matched = RoutesFor(rules, event)
+		}
+	}
+
+	if len(matched) == 0 {
+		return everywhere(all, event), nil
+	}
+
+	var errs []error
+	ret := []delivery{}
+	seen := map[destination]bool{}
+
+	for _, route := range matched {
+		for _, d := range parseDestinations(route.Destinations) {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+
+			idx := slices.IndexFunc(all, func(n Notifier) bool { return n.Name() == d.notifier })
+			if idx == -1 {
+				errs = append(errs, fmt.Errorf("route %d: notifier not configured: %s", route.Id, d.notifier))
+				continue
+			}
+
+			routed := event
+			routed.Channel = d.channel
+			routed.Severity = route.Severity
+			ret = append(ret, delivery{notifier: all[idx], event: routed})
+		}
+	}
+
+	if len(ret) == 0 {
+		log.Printf("No notifier of the alert routes is configured, sending to every notifier")
+		return everywhere(all, event), errors.Join(errs...)
+	}
+
+	return ret, errors.Join(errs...)
+}
+
+func everywhere(all []Notifier, event Event) []delivery {
+	ret := []delivery{}
+	for _, notifier := range all {
+		ret = append(ret, delivery{notifier: notifier, event: event})
+	}
+	return ret
+}
@@ -0,0 +1,135 @@
+package alerts_test
+
+import (
+	"errors"
+	"monitor2/src/alerts"
+	"monitor2/src/db/models"
+	"testing"
+)
+
+func TestRoutesMatchTags(t *testing.T) {
+	route := models.Route{TargetType: "endpoint", Tag: "payments", Destinations: "discord", Severity: "info"}
+
+	event := alerts.Event{Source: alerts.SourceCrawler, Url: "https://example.com", Tags: []string{"payments"}}
+	if !alerts.Matches(route, event) {
+		t.Fatal("tagged endpoint not matched")
+	}
+
+	event.Source = alerts.SourceRepository
+	if alerts.Matches(route, event) {
+		t.Fatal("repository matched an endpoint route")
+	}
+}
+
+func TestAlertFollowsRoutes(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+	defer alerts.SetRoutes(nil)
+
+	team := &fakeNotifier{name: "team"}
+	other := &fakeNotifier{name: "other"}
+	alerts.Register(team)
+	alerts.Register(other)
+
+	alerts.SetRoutes(func() ([]models.Route, error) {
+		return []models.Route{
+			{Id: 1, UrlPattern: `^https://api\.example\.com/`, Destinations: "team:1234", Severity: alerts.SeverityCritical},
+		}, nil
+	})
+
+	err := alerts.Alert(alerts.Event{Source: alerts.SourceCrawler, Kind: alerts.KindDiff, Url: "https://api.example.com/config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(team.events) != 1 || len(other.events) != 0 {
+		t.Fatal(team.events, other.events)
+	}
+
+	if team.events[0].Channel != "1234" || team.events[0].Severity != alerts.SeverityCritical {
+		t.Fatal(team.events[0])
+	}
+
+	err = alerts.Alert(alerts.Event{Source: alerts.SourceCrawler, Kind: alerts.KindDiff, Url: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(team.events) != 2 || len(other.events) != 1 {
+		t.Fatal("unrouted event didn't go to every notifier")
+	}
+}
+
+func TestAlertWithoutRoutesGoesEverywhere(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+	defer alerts.SetRoutes(nil)
+
+	team := &fakeNotifier{name: "team"}
+	other := &fakeNotifier{name: "other"}
+	alerts.Register(team)
+	alerts.Register(other)
+
+	alerts.SetRoutes(func() ([]models.Route, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	err := alerts.Alert(alerts.Event{Source: alerts.SourceCrawler, Kind: alerts.KindError, Url: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(team.events) != 1 || len(other.events) != 1 {
+		t.Fatal(team.events, other.events)
+	}
+}
+
+func TestValidateRouteNeedsTargetType(t *testing.T) {
+	route := models.Route{TargetId: 3, Destinations: "discord", Severity: alerts.SeverityInfo}
+	if err := alerts.ValidateRoute(route); err == nil {
+		t.Fatal("target_id without target_type accepted")
+	}
+
+	route.TargetType = "repository"
+	if err := alerts.ValidateRoute(route); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlertWithUnconfiguredRouteGoesEverywhere(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+	defer alerts.SetRoutes(nil)
+
+	team := &fakeNotifier{name: "team"}
+	alerts.Register(team)
+
+	alerts.SetRoutes(func() ([]models.Route, error) {
+		return []models.Route{{Id: 1, Destinations: "email:alice@example.com", Severity: alerts.SeverityInfo}}, nil
+	})
+
+	err := alerts.Alert(alerts.Event{Source: alerts.SourceCrawler, Kind: alerts.KindDiff, Url: "https://example.com"})
+	if err == nil {
+		t.Fatal("unconfigured notifier not reported")
+	}
+
+	if len(team.events) != 1 {
+		t.Fatal(team.events)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	for back, want := range map[string]string{
+		"/routes?id=3":      "/routes?id=3",
+		"/crawl":            "/crawl",
+		"//evil.com":        "/routes",
+		"/\\evil.com":       "/routes",
+		"/\t/evil.com":      "/routes",
+		"https://evil.com/": "/routes",
+		"":                  "/routes",
+	} {
+		if got := alerts.LocalPath(back, "/routes"); got != want {
+			t.Fatalf("%q: got %q", back, got)
+		}
+	}
+}
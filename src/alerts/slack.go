@@ -0,0 +1,208 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Section blocks accept at most 3000 characters,
+// leave some room for the code fences and the truncation note.
+const slackMaxDiff = 2800
+
+type Slack struct {
+	url       string
+	error_url string
+	client    *http.Client
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackButton struct {
+	Type string    `json:"type"`
+	Text SlackText `json:"text"`
+	Url  string    `json:"url"`
+}
+
+// Elements holds SlackText for context blocks and SlackButton for actions.
+type SlackBlock struct {
+	Type     string     `json:"type"`
+	Text     *SlackText `json:"text,omitempty"`
+	Elements []any      `json:"elements,omitempty"`
+}
+
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+func init() {
+	RegisterFactory("slack", slackFromEnv)
+}
+
+func slackFromEnv() (Notifier, error) {
+	url := os.Getenv("SLACK_WEBHOOK_URL")
+	if len(url) == 0 {
+		return nil, nil
+	}
+
+	slack := NewSlack(url)
+	slack.error_url = os.Getenv("SLACK_ERROR_WEBHOOK_URL")
+	return slack, nil
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Notify(event Event) error {
+	body, err := json.Marshal(SlackMessageFor(event))
+	if err != nil {
+		return err
+	}
+
+	url := s.url
+	if strings.HasPrefix(event.Channel, "http") {
+		url = event.Channel
+	}
+	if event.Kind == KindError && len(s.error_url) != 0 {
+		url = s.error_url
+	}
+
+	response, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// SlackMessageFor renders event as Block Kit blocks.
+func SlackMessageFor(event Event) SlackMessage {
+	title := "Endpoint changed"
+	if event.Source == SourceRepository {
+		title = "Repository changed"
+	}
+	if event.Kind == KindStatusCode {
+		title = "Status code changed"
+	}
+	if event.Kind == KindRedirect {
+		title = "Redirect target changed"
+	}
+	if event.Kind == KindError {
+		title = "Monitor failing"
+	}
+	if event.Severity != "" && event.Severity != SeverityInfo {
+		title = "[" + event.Severity + "] " + title
+	}
+
+	blocks := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: title}},
+		{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "<" + slackEscape(event.Url) + ">"}},
+	}
+
+	if event.Kind == KindStatusCode {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("previous: *%d*\nnew: *%d*", event.OldStatusCode, event.NewStatusCode),
+			},
+		})
+	}
+
+	if event.Kind == KindRedirect {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("previous: %s\nnew: %s", slackEscape(event.OldLocation), slackEscape(event.NewLocation)),
+			},
+		})
+	}
+
+	if event.Kind == KindError {
+		error_text, _ := truncateLines(slackEscape(event.Error), slackMaxDiff)
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("stage: *%s*\nconsecutive failures: *%d*\n```%s```", event.Stage, event.Failures, error_text),
+			},
+		})
+	}
+
+	if len(event.Body) != 0 {
+		diff, truncated := truncateLines(slackEscape(event.Body), slackMaxDiff)
+
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: "```" + diff + "```"},
+		})
+
+		if truncated {
+			note := "_diff truncated_"
+			if len(event.Link) != 0 {
+				note = fmt.Sprintf("_diff truncated, <%s|see the full diff>_", slackEscape(event.Link))
+			}
+
+			blocks = append(blocks, SlackBlock{
+				Type:     "context",
+				Elements: []any{SlackText{Type: "mrkdwn", Text: note}},
+			})
+		}
+	}
+
+	if len(event.Link) != 0 {
+		blocks = append(blocks, SlackBlock{
+			Type: "actions",
+			Elements: []any{SlackButton{
+				Type: "button",
+				Text: SlackText{Type: "plain_text", Text: "View diff"},
+				Url:  event.Link,
+			}},
+		})
+	}
+
+	return SlackMessage{
+		Text:   title + ": " + event.Url,
+		Blocks: blocks,
+	}
+}
+
+// truncateLines cuts s to at most max bytes without splitting a line.
+func truncateLines(s string, max int) (string, bool) {
+	if len(s) <= max {
+		return s, false
+	}
+
+	cut := strings.LastIndex(s[:max], "\n")
+	if cut <= 0 {
+		return s[:max], true
+	}
+
+	return s[:cut+1], true
+}
+
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,47 @@
+package alerts_test
+
+import (
+	"encoding/json"
+	"monitor2/src/alerts"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackTruncatesLongDiffs(t *testing.T) {
+	var message map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := json.NewDecoder(r.Body).Decode(&message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	slack := alerts.NewSlack(srv.URL)
+	err := slack.Notify(alerts.Event{
+		Source: alerts.SourceRepository,
+		Kind:   alerts.KindDiff,
+		Url:    "https://github.com/shafouz/monitor",
+		Body:   strings.Repeat("+some added line\n", 1000),
+		Link:   "http://localhost:3000/diff/1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := message["blocks"].([]any)
+	for _, block := range blocks {
+		text, ok := block.(map[string]any)["text"].(map[string]any)
+		if ok && len(text["text"].(string)) > 3000 {
+			t.Fatal("block over the slack limit")
+		}
+	}
+
+	raw, _ := json.Marshal(message)
+	if !strings.Contains(string(raw), "diff truncated") || !strings.Contains(string(raw), "/diff/1234") {
+		t.Fatal(string(raw))
+	}
+}
@@ -0,0 +1,226 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SignatureHeader = "X-Monitor2-Signature-256"
+
+type Webhook struct {
+	url     string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	client  *http.Client
+	record  func(delivery models.WebhookDelivery) error
+
+	// failed deliveries are retried in the background, Drain waits for them
+	retrying sync.WaitGroup
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type WebhookPayload struct {
+	Source        Source    `json:"source"`
+	Kind          Kind      `json:"kind"`
+	Url           string    `json:"url"`
+	OldStatusCode int       `json:"old_status_code"`
+	NewStatusCode int       `json:"new_status_code"`
+	OldLocation   string    `json:"old_location,omitempty"`
+	NewLocation   string    `json:"new_location,omitempty"`
+	Diff          string    `json:"diff"`
+	DiffId        string    `json:"diff_id,omitempty"`
+	Link          string    `json:"link,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	Stage         string    `json:"stage,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Failures      int       `json:"failures,omitempty"`
+	Severity      string    `json:"severity,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+}
+
+func init() {
+	RegisterFactory("webhook", webhookFromEnv)
+}
+
+func webhookFromEnv() (Notifier, error) {
+	url := os.Getenv("WEBHOOK_URL")
+	if len(url) == 0 {
+		return nil, nil
+	}
+
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if len(secret) == 0 {
+		return nil, errors.New("WEBHOOK_SECRET is empty")
+	}
+
+	webhook := NewWebhook(url, secret)
+
+	retries, err := intFromEnv("WEBHOOK_RETRIES", webhook.retries)
+	if err != nil {
+		return nil, err
+	}
+	webhook.retries = retries
+
+	webhook.record = func(delivery models.WebhookDelivery) error {
+		return database.DB.CreateWebhookDelivery(delivery)
+	}
+
+	return webhook, nil
+}
+
+func NewWebhook(url string, secret string) *Webhook {
+	return &Webhook{
+		url:     url,
+		secret:  []byte(secret),
+		retries: 3,
+		backoff: time.Second,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		stop:    make(chan struct{}),
+	}
+}
+
+// SignPayload returns the value of the signature header for body.
+// Receivers recompute it with the shared secret and compare.
+func SignPayload(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (wh *Webhook) Name() string {
+	return "webhook"
+}
+
+func (wh *Webhook) Notify(event Event) error {
+	body, err := json.Marshal(WebhookPayload{
+		Source:        event.Source,
+		Kind:          event.Kind,
+		Url:           event.Url,
+		OldStatusCode: event.OldStatusCode,
+		NewStatusCode: event.NewStatusCode,
+		OldLocation:   event.OldLocation,
+		NewLocation:   event.NewLocation,
+		Diff:          event.Body,
+		DiffId:        event.DiffId,
+		Link:          event.Link,
+		Timestamp:     event.Time,
+		Stage:         event.Stage,
+		Error:         event.Error,
+		Failures:      event.Failures,
+		Severity:      event.Severity,
+		Tags:          event.Tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := wh.url
+	if strings.HasPrefix(event.Channel, "http") {
+		url = event.Channel
+	}
+
+	status_code, err := wh.post(url, body)
+	if err == nil {
+		return nil
+	}
+
+	if wh.retries < 1 {
+		wh.failed(url, body, 1, status_code, err)
+		return err
+	}
+
+	// retried without holding the crawl or pull that sent it
+	log.Printf("webhook delivery to %s failed, retrying: %+v", url, err)
+	wh.retrying.Add(1)
+	go func() {
+		defer wh.retrying.Done()
+		wh.retry(url, body, status_code, err)
+	}()
+	return nil
+}
+
+// retry posts body until it gets a 2xx or runs out of retries,
+// doubling the wait between attempts. Once Drain was called it stops waiting.
+func (wh *Webhook) retry(url string, body []byte, status_code int, err error) {
+	backoff := wh.backoff
+	attempts := 1
+
+	for ; err != nil && attempts <= wh.retries; attempts++ {
+		select {
+		case <-time.After(backoff):
+		case <-wh.stop:
+		}
+		backoff *= 2
+
+		status_code, err = wh.post(url, body)
+	}
+
+	if err != nil {
+		wh.failed(url, body, attempts, status_code, err)
+	}
+}
+
+// failed logs and records a delivery that ran out of attempts.
+func (wh *Webhook) failed(url string, body []byte, attempts int, status_code int, err error) {
+	log.Printf("webhook delivery to %s failed after %d attempt(s): %+v", url, attempts, err)
+
+	if wh.record == nil {
+		return
+	}
+
+	record_err := wh.record(models.WebhookDelivery{
+		Url:        url,
+		Payload:    string(body),
+		Attempts:   attempts,
+		StatusCode: status_code,
+		Error:      err.Error(),
+	})
+	if record_err != nil {
+		log.Printf("Could not record webhook delivery: %+v", record_err)
+	}
+}
+
+// Drain retries the pending deliveries right away and waits for them, used on shutdown.
+func (wh *Webhook) Drain() error {
+	wh.once.Do(func() { close(wh.stop) })
+	wh.retrying.Wait()
+	return nil
+}
+
+func (wh *Webhook) post(url string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "monitor2")
+	req.Header.Set(SignatureHeader, SignPayload(wh.secret, body))
+
+	response, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
@@ -0,0 +1,96 @@
+package alerts_test
+
+import (
+	"encoding/json"
+	"io"
+	"monitor2/src/alerts"
+	"monitor2/src/db/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSignsPayload(t *testing.T) {
+	var payload alerts.WebhookPayload
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r.Header.Get(alerts.SignatureHeader) != alerts.SignPayload([]byte("s3cr3t"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	webhook := alerts.NewTestWebhook(srv.URL, "s3cr3t", 0, nil)
+	err := webhook.Notify(alerts.Event{
+		Source: alerts.SourceRepository,
+		Kind:   alerts.KindDiff,
+		Url:    "https://github.com/shafouz/monitor",
+		Body:   "+a\n",
+		DiffId: "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.DiffId != "1234" || payload.Diff != "+a\n" {
+		t.Fatal(payload)
+	}
+}
+
+func TestWebhookRetriesAndRecords(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	var recorded []models.WebhookDelivery
+	webhook := alerts.NewTestWebhook(srv.URL, "s3cr3t", 2, func(delivery models.WebhookDelivery) error {
+		recorded = append(recorded, delivery)
+		return nil
+	})
+
+	// retried in the background
+	err := webhook.Notify(alerts.Event{Url: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = webhook.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Fatal(calls)
+	}
+
+	if len(recorded) != 1 || recorded[0].Attempts != 3 || recorded[0].StatusCode != http.StatusBadGateway {
+		t.Fatal(recorded)
+	}
+}
+
+func TestWebhookWithoutRetriesFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	webhook := alerts.NewTestWebhook(srv.URL, "s3cr3t", 0, nil)
+	err := webhook.Notify(alerts.Event{Url: "https://example.com"})
+	if err == nil {
+		t.Fatal("expected delivery error")
+	}
+}
@@ -1,14 +1,21 @@
 package monitor2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"monitor2/src/alerts"
 	"monitor2/src/crawler"
 	database "monitor2/src/db"
 	"monitor2/src/diffs"
 	"monitor2/src/repositories"
+	"monitor2/src/runs"
+	"monitor2/src/secrets"
+	"monitor2/src/sessions"
+	"monitor2/src/workers"
 	"strconv"
+	"sync"
 	"time"
 
 	"net/http"
@@ -21,6 +28,11 @@ type App struct {
 	Router    *mux.Router
 	DB        *database.Database
 	templates *template.Template
+	// cancelled at the shutdown deadline like the scheduled jobs
+	Jobs context.Context
+
+	mu     sync.Mutex
+	server *http.Server
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -28,7 +40,9 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		var headers []byte
 		var err error
 
-		headers, err = json.Marshal(&r.Header)
+		// credentials never reach the logs
+		redacted := secrets.RedactHeaders(r.Header)
+		headers, err = json.Marshal(&redacted)
 		if err != nil {
 			log.Print(err)
 		}
@@ -44,6 +58,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Init sets up the routes and the server listening on addr, Serve starts it.
 func (app *App) Init(addr string) {
 	app.templates = template.Must(template.ParseGlob("static/templates/*.html"))
 
@@ -58,6 +73,8 @@ func (app *App) Init(addr string) {
 	app.Router.HandleFunc("/crawl/d", crawler.DeleteEndpoint)
 	app.Router.HandleFunc("/crawl/run", app.RunSchedule)
 	app.Router.HandleFunc("/crawl/run_single", crawler.RunEndpoint)
+	app.Router.HandleFunc("/crawl/{id}/history", crawler.History)
+	app.Router.HandleFunc("/crawl/{id}/compare", crawler.Compare)
 
 	app.Router.HandleFunc("/repos", repositories.Repos)
 	app.Router.HandleFunc("/repos/c", repositories.CreateRepo)
@@ -66,6 +83,24 @@ func (app *App) Init(addr string) {
 	app.Router.HandleFunc("/diffs", diffs.Diffs)
 	app.Router.HandleFunc("/diff/{id}", diffs.Diff)
 
+	app.Router.HandleFunc("/runs", runs.Runs)
+
+	app.Router.HandleFunc("/secrets", secrets.Secrets)
+	app.Router.HandleFunc("/secrets/c", secrets.CreateSecret)
+	app.Router.HandleFunc("/secrets/rotate", secrets.RotateSecret)
+	app.Router.HandleFunc("/secrets/d", secrets.DeleteSecret)
+
+	app.Router.HandleFunc("/sessions", sessions.Sessions)
+	app.Router.HandleFunc("/sessions/c", sessions.CreateSession)
+	app.Router.HandleFunc("/sessions/u", sessions.UpdateSession)
+	app.Router.HandleFunc("/sessions/d", sessions.DeleteSession)
+
+	app.Router.HandleFunc("/alerts", alerts.Alerts)
+	app.Router.HandleFunc("/routes", alerts.Routes)
+	app.Router.HandleFunc("/routes/c", alerts.CreateRoute)
+	app.Router.HandleFunc("/routes/u", alerts.UpdateRoute)
+	app.Router.HandleFunc("/routes/d", alerts.DeleteRoute)
+
 	srv := &http.Server{
 		Handler:      app.Router,
 		Addr:         addr,
@@ -73,22 +108,46 @@ func (app *App) Init(addr string) {
 		ReadTimeout:  15 * time.Second,
 	}
 
-	log.Printf("Starting server at: %s", addr)
+	app.mu.Lock()
+	app.server = srv
+	app.mu.Unlock()
+}
+
+// Serve listens on the address given to Init until Shutdown,
+// it returns right away when Shutdown already ran.
+func (app *App) Serve() {
+	app.mu.Lock()
+	srv := app.server
+	app.mu.Unlock()
+
+	log.Printf("Starting server at: %s", srv.Addr)
 	err := srv.ListenAndServe()
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal().Err(err).Msg("")
 	}
 }
 
-func (_ App) HomeHandler(w http.ResponseWriter, r *http.Request) {
+// Shutdown stops accepting connections and waits for the running requests until ctx is done.
+func (app *App) Shutdown(ctx context.Context) error {
+	app.mu.Lock()
+	srv := app.server
+	app.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+func (_ *App) HomeHandler(w http.ResponseWriter, r *http.Request) {
   http.ServeFile(w, r, "static/index.html")
 }
 
-func (_ App) HealthCheck(w http.ResponseWriter, r *http.Request) {
+func (_ *App) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK\n")
 }
 
-func (app App) RunSchedule(w http.ResponseWriter, r *http.Request) {
+func (app *App) RunSchedule(w http.ResponseWriter, r *http.Request) {
 	s := r.PostFormValue("s")
 	if len(s) == 0 {
 		fmt.Fprintf(w, "Missing 's' param")
@@ -101,7 +160,17 @@ func (app App) RunSchedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	n, errors := crawler.RunBySchedule(schedule, &database.DB)
+	// claimed like scheduled runs, so every endpoint runs on a single replica
+	// and its next run moves on, what doesn't fit in the idle workers runs on the next polls
+	now := time.Now()
+	_, err = database.DB.MarkEndpointsDue(schedule, now)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	lease := seconds_from_env("SCHEDULER_LEASE_SECONDS", default_lease)
+	n, errors := crawler.RunDue(app.Jobs, now, lease, workers.Default.Free(), &database.DB)
 	if len(errors) != 0 {
 		fmt.Fprint(w, errors)
 		return
@@ -0,0 +1,323 @@
+package commands
+
+import (
+	"fmt"
+	"monitor2/src/alerts"
+	"monitor2/src/crawler"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"monitor2/src/repositories"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// discord rejects longer messages
+const max_message = 2000
+
+// and longer option descriptions
+const max_description = 100
+
+// only members that can manage the server see the commands by default
+var manage_server int64 = discordgo.PermissionManageServer
+
+var Commands = []*discordgo.ApplicationCommand{
+	{
+		Name:                     "monitor",
+		Description:              "Manage crawled endpoints",
+		DefaultMemberPermissions: &manage_server,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Start monitoring an endpoint",
+				Options:     monitor_add_options(),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List monitored endpoints",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "run",
+				Description: "Crawl an endpoint now",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "url", Description: "Endpoint url", Required: true, Autocomplete: true},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "repo",
+		Description:              "Manage watched repositories",
+		DefaultMemberPermissions: &manage_server,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Start watching files of a repository",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "url", Description: "Repository url", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "files", Description: `JSON array, e.g. ["routes.py"]`, Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List watched repositories",
+			},
+		},
+	},
+	{
+		Name:                     "diff",
+		Description:              "Show stored diffs",
+		DefaultMemberPermissions: &manage_server,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "show",
+				Description: "Show a diff by id",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "Diff id", Required: true},
+				},
+			},
+		},
+	},
+}
+
+// profile choices and params come from the extractor registry
+func monitor_add_options() []*discordgo.ApplicationCommandOption {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, profile := range crawler.Profiles() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: profile, Value: profile})
+	}
+
+	options := []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "url", Description: "Endpoint url", Required: true},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "profile",
+			Description: "Extraction profile",
+			Required:    true,
+			Choices:     choices,
+		},
+	}
+	for _, param := range crawler.Params() {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        param.Name,
+			Description: truncateDescription(param.Description),
+		})
+	}
+	return options
+}
+
+// Init registers the commands when DISCORD_COMMANDS=true.
+// With several replicas every one connected to the gateway would answer,
+// so they are off by default and only one of them should enable them.
+func Init() error {
+	if enabled, err := strconv.ParseBool(os.Getenv("DISCORD_COMMANDS")); err != nil || !enabled {
+		return nil
+	}
+	return alerts.RegisterCommands(Commands, handle)
+}
+
+func handle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocomplete(s, i)
+	case discordgo.InteractionApplicationCommand:
+		command(s, i)
+	}
+}
+
+func command(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return
+	}
+
+	subcommand := data.Options[0]
+	options := map[string]string{}
+	for _, option := range subcommand.Options {
+		options[option.Name] = option.StringValue()
+	}
+
+	// crawls and clones take longer than the 3s discord gives us to answer
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return
+	}
+
+	content := truncate(Dispatch(data.Name, subcommand.Name, options))
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+}
+
+// Dispatch runs a command with the same logic as the http handlers
+// and returns the reply.
+func Dispatch(command string, subcommand string, options map[string]string) string {
+	switch command + " " + subcommand {
+	case "monitor add":
+		endpoint := models.Endpoint{
+			Url:     options["url"],
+			Profile: options["profile"],
+		}
+		crawler.SetParams(&endpoint, func(name string) string { return options[name] })
+
+		err := crawler.Create(endpoint)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Done: %+v", endpoint.Url)
+
+	case "monitor list":
+		endpoints, err := database.DB.GetAllEndpoints()
+		if err != nil {
+			return err.Error()
+		}
+
+		var b strings.Builder
+		for _, endpoint := range endpoints {
+			if endpoint.Deleted {
+				continue
+			}
+			fmt.Fprintf(&b, "%s (%s)\n", endpoint.Url, endpoint.Profile)
+		}
+		if b.Len() == 0 {
+			return "No endpoints."
+		}
+		return b.String()
+
+	case "monitor run":
+		err := crawler.Run(options["url"])
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Done: %+v", options["url"])
+
+	case "repo add":
+		err := repositories.Create(models.Repository{
+			Url:          options["url"],
+			WatchedFiles: []byte(options["files"]),
+		})
+		if err != nil {
+			return err.Error()
+		}
+		return "Repo created"
+
+	case "repo list":
+		repos, err := database.DB.GetAllRepos()
+		if err != nil {
+			return err.Error()
+		}
+
+		var b strings.Builder
+		for _, repo := range repos {
+			if repo.Deleted {
+				continue
+			}
+			fmt.Fprintf(&b, "%s %s\n", repo.Url, repo.WatchedFiles)
+		}
+		if b.Len() == 0 {
+			return "No repositories."
+		}
+		return b.String()
+
+	case "diff show":
+		diff, err := database.DB.GetDiff(options["id"])
+		if err != nil {
+			return err.Error()
+		}
+
+		link := fmt.Sprintf("%s/diff/%s", os.Getenv("NGROK_URL"), diff.Id)
+		header := fmt.Sprintf("%s\n%s\n", diff.Url, link)
+		body := strings.ReplaceAll(diff.Body, "```", "'''")
+		return header + "```diff\n" + truncateBody(body, max_message-len(header)-12) + "```"
+	}
+
+	return fmt.Sprintf("Unknown command: %s %s", command, subcommand)
+}
+
+func autocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return
+	}
+
+	typed := ""
+	for _, option := range data.Options[0].Options {
+		if option.Focused {
+			typed = option.StringValue()
+		}
+	}
+
+	urls, err := database.DB.GetAllUrls()
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: Choices(urls, typed),
+		},
+	})
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+}
+
+// Choices returns the urls containing typed, discord accepts at most 25.
+func Choices(urls []string, typed string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, url := range urls {
+		if len(choices) == 25 {
+			break
+		}
+
+		// names and values are limited to 100 characters
+		if len(url) > 100 || !strings.Contains(url, typed) {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: url, Value: url})
+	}
+	return choices
+}
+
+func truncate(s string) string {
+	if len(s) <= max_message {
+		return s
+	}
+	return s[:max_message-4] + "\n..."
+}
+
+func truncateDescription(s string) string {
+	if len(s) <= max_description {
+		return s
+	}
+	return s[:max_description-3] + "..."
+}
+
+func truncateBody(s string, max int) string {
+	if max < 0 {
+		max = 0
+	}
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "\n..."
+}
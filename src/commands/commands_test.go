@@ -0,0 +1,39 @@
+package commands_test
+
+import (
+	"fmt"
+	"monitor2/src/commands"
+	"testing"
+)
+
+func TestChoicesFiltersUrls(t *testing.T) {
+	urls := []string{
+		"https://example.com/app.js",
+		"https://example.com/login",
+		"https://other.com/",
+	}
+
+	choices := commands.Choices(urls, "example.com")
+	if len(choices) != 2 {
+		t.Fatal(choices)
+	}
+}
+
+func TestChoicesAreCapped(t *testing.T) {
+	urls := []string{}
+	for i := 0; i < 30; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	choices := commands.Choices(urls, "")
+	if len(choices) != 25 {
+		t.Fatal(len(choices))
+	}
+}
+
+func TestDispatchUnknownCommand(t *testing.T) {
+	reply := commands.Dispatch("monitor", "nope", map[string]string{})
+	if reply != "Unknown command: monitor nope" {
+		t.Fatal(reply)
+	}
+}
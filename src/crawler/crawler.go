@@ -2,47 +2,222 @@ package crawler
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"monitor2/src/alerts"
 	database "monitor2/src/db"
 	models "monitor2/src/db/models"
+	"monitor2/src/runs"
+	"monitor2/src/schedule"
+	"monitor2/src/sessions"
+	"monitor2/src/workers"
 	"monitor2/utils"
 	diff "monitor2/utils"
-	"path/filepath"
+	"os"
+	"strings"
+	"time"
 
 	"net/http"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
 )
 
-func RunBySchedule(schedule int, db *database.Database) (int, []error) {
+// RunDue crawls every endpoint whose next run is before now
+// and schedules its following run. The crawls are submitted to the worker pool
+// without waiting for them, the errors are only the ones of claiming and scheduling.
+// Claimed endpoints that don't start within lease, e.g. because the replica died,
+// are picked up again.
+func RunDue(ctx context.Context, now time.Time, lease time.Duration, limit int, db *database.Database) (int, []error) {
 	var errors []error
 
-	endpoints, err := db.GetManyEndpointsBySchedule(schedule)
+	endpoints, err := db.ClaimDueEndpoints(now, now.Add(lease), limit)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
 		errors = append(errors, err)
 		return 0, errors
 	}
 
+	jobs := []workers.Job{}
 	for _, endpoint := range endpoints {
-		err := RunSingle(&endpoint)
+		next, err := schedule.Next(endpoint.ScheduleHours, endpoint.ScheduleCron, endpoint.Timezone, now)
 		if err != nil {
-			log.Err(err).Caller().Msg("")
+			// keep running by interval until the cron expression is fixed
 			errors = append(errors, err)
+			report_failure(endpoint, alerts.Stage("schedule", err))
+			next, _ = schedule.Next(endpoint.ScheduleHours, "", "", now)
 		}
 
-		err = db.UpdateEndpointByUrl(endpoint, true)
-		if err != nil {
-			log.Err(err).Caller().Msg("")
-			errors = append(errors, err)
+		// set once the job starts, a failing endpoint waits for its next run too
+		id := endpoint.Id
+		job := endpoint_job(endpoint, db)
+		job.Start = func() error {
+			return db.SetEndpointRun(id, time.Now(), next)
+		}
+		// skipped on shutdown, due again right away instead of after the lease
+		job.Skip = func() {
+			err := db.ReleaseEndpoint(id, now.Add(lease), time.Now())
+			if err != nil {
+				log.Err(err).Caller().Msg("")
+			}
 		}
+		jobs = append(jobs, job)
 	}
+	workers.Default.Submit(ctx, jobs)
 
 	return len(endpoints), errors
 }
 
+func endpoint_job(endpoint models.Endpoint, db *database.Database) workers.Job {
+	return workers.Job{
+		Host: workers.Host(endpoint.Url),
+		Run: func(ctx context.Context) error {
+			return errors.Join(run_endpoint(ctx, endpoint, db)...)
+		},
+	}
+}
+
+func run_endpoint(ctx context.Context, endpoint models.Endpoint, db *database.Database) []error {
+	var errors []error
+
+	err := RunSingle(ctx, &endpoint)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		errors = append(errors, err)
+		endpoint.ConsecutiveFailures++
+		report_failure(endpoint, err)
+	} else {
+		endpoint.ConsecutiveFailures = 0
+	}
+
+	err = db.UpdateEndpointByUrl(endpoint, true)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		errors = append(errors, err)
+		report_failure(endpoint, alerts.Stage("update", err))
+	}
+
+	return errors
+}
+
+// alert_target is the base event for alerts about endpoint, used for routing.
+func alert_target(endpoint models.Endpoint) alerts.Event {
+	return alerts.Event{
+		Source:   alerts.SourceCrawler,
+		TargetId: endpoint.Id,
+		Tags:     utils.SplitList(endpoint.Tags),
+		Url:      endpoint.Url,
+	}
+}
+
+// Validate checks the fields needed to crawl endpoint.
+func Validate(endpoint models.Endpoint) error {
+	if len(endpoint.Profile) == 0 {
+		return errors.New("Missing 'profile' param")
+	}
+
+	if err := validate_params(endpoint); err != nil {
+		return err
+	}
+
+	if err := validate_request(endpoint); err != nil {
+		return err
+	}
+
+	if len(endpoint.Url) == 0 {
+		return errors.New("Missing 'url' param")
+	}
+
+	if endpoint.ScheduleHours < 0 {
+		return errors.New("schedule_hours must be positive")
+	}
+
+	if endpoint.TimeoutSeconds < 0 {
+		return errors.New("timeout_seconds must be positive")
+	}
+
+	return schedule.Validate(endpoint.ScheduleCron, endpoint.Timezone)
+}
+
+// DefaultScheduleHours is used when an endpoint is created without a schedule.
+const DefaultScheduleHours = 8
+
+// Create stores a new endpoint and crawls it once to set the baseline.
+func Create(endpoint models.Endpoint) error {
+	err := Validate(endpoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = SealCredentials(&endpoint)
+	if err != nil {
+		return err
+	}
+
+	if endpoint.ScheduleHours == 0 {
+		endpoint.ScheduleHours = DefaultScheduleHours
+	}
+	endpoint.NextRunAt, err = schedule.Next(endpoint.ScheduleHours, endpoint.ScheduleCron, endpoint.Timezone, time.Now())
+	if err != nil {
+		return err
+	}
+
+	endpoint.Id, err = database.DB.CreateEndpoint(endpoint)
+	if err != nil {
+		return fmt.Errorf("on create: %+v", err)
+	}
+
+	err = run_now(&endpoint)
+	if err != nil {
+		return err
+	}
+
+	err = database.DB.UpdateEndpointByUrl(endpoint, true)
+	if err != nil {
+		return fmt.Errorf("on update: %+v", err)
+	}
+
+	return nil
+}
+
+// Run crawls the endpoint with url right away.
+func Run(url string) error {
+	if len(url) == 0 {
+		return errors.New("Missing 'url' param")
+	}
+
+	endpoint, err := database.DB.GetEndpointByUrl(url)
+	if err != nil {
+		return err
+	}
+
+	err = run_now(&endpoint)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.UpdateEndpointByUrl(endpoint, true)
+}
+
+// run_now crawls endpoint right away, still within the worker pool limits.
+func run_now(endpoint *models.Endpoint) error {
+	return workers.Default.Do(context.Background(), workers.Job{
+		Host: workers.Host(endpoint.Url),
+		Run: func(ctx context.Context) error {
+			return RunSingle(ctx, endpoint)
+		},
+	})
+}
+
+func report_failure(endpoint models.Endpoint, err error) {
+	err = alerts.Failure(alert_target(endpoint), err, endpoint.ConsecutiveFailures)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+}
+
 func filter_matches(matches [][]byte) [][]byte {
 	ret := [][]byte{}
 	blocklist := [][]byte{
@@ -74,64 +249,235 @@ func filter_matches(matches [][]byte) [][]byte {
 	return ret
 }
 
-func RunSingle(endpoint *models.Endpoint) error {
+// RunSingle crawls endpoint once and records the run.
+func RunSingle(ctx context.Context, endpoint *models.Endpoint) error {
+	run := models.Run{
+		TargetType: alerts.TargetType(alerts.SourceCrawler),
+		TargetId:   endpoint.Id,
+		Url:        endpoint.Url,
+		StartedAt:  time.Now(),
+	}
+
+	err := run_single(ctx, endpoint, &run)
+	runs.Record(&database.DB, run, err)
+	return err
+}
+
+func run_single(ctx context.Context, endpoint *models.Endpoint, run *models.Run) error {
 	var response_body [][]byte
 	var err error
 
-	body, status_code, err := crawl(endpoint)
+	page, err := crawl(ctx, endpoint)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return err
-	}
-
-	switch endpoint.Profile {
-	case "html":
-		path, err := filepath.Abs("src/crawler/scripts/crawl_html.py")
-		if err != nil {
-			log.Err(err).Caller().Msg("")
+		// login failures keep their own stage
+		var stage_err *alerts.StageError
+		if errors.As(err, &stage_err) {
 			return err
 		}
-		response_body, err = html_handler(path, body, endpoint.Selector)
-		if err != nil {
-			log.Err(err).Caller().Msg("")
+		return alerts.Stage("fetch", err)
+	}
+	body, status_code := page.body, page.status_code
+	run.StatusCode = status_code
+	run.Bytes = len(body)
+
+	if status_code == http.StatusNotModified {
+		// the stored response is still current, nothing to extract or diff
+		alerts.Unchanged(endpoint.Url)
+		return nil
+	}
+
+	hash := content_hash(body)
+	// same raw body as the stored response, so the same extracted lines
+	unchanged := hash == endpoint.ContentHash && status_code == endpoint.StatusCode
+	keep_baseline := false
+	// the diff is stored before the alert, a failed alert still moves the baseline
+	// so the next run doesn't store and send it again
+	var alert_err error
+
+	if unchanged {
+		alerts.Unchanged(endpoint.Url)
+	} else {
+		response_body, keep_baseline, err = diff_body(ctx, endpoint, body, status_code, run)
+		var stage_err *alerts.StageError
+		if errors.As(err, &stage_err) && stage_err.Stage == "alert" {
+			alert_err = err
+		} else if err != nil {
 			return err
 		}
-	default:
-		path, err := filepath.Abs("src/crawler/scripts/crawl_js.py")
-		if err != nil {
-			log.Err(err).Caller().Msg("")
-			return err
+	}
+
+	// signed cdn urls and session ids change on every run, only the location counts
+	keep_location := false
+	redirect_target := "redirect " + endpoint.Url
+	old_location, new_location := without_query(endpoint.FinalUrl), without_query(page.final_url)
+	if endpoint.FinalUrl != "" && old_location != new_location {
+		event := alert_target(*endpoint)
+		event.Kind = alerts.KindRedirect
+		event.OldLocation = endpoint.FinalUrl
+		event.NewLocation = page.final_url
+		event.Body = strings.Join(page.redirects, "\n")
+
+		verdict := alerts.Check(redirect_target, alerts.Fingerprint([][]byte{[]byte(old_location)}), alerts.Fingerprint([][]byte{[]byte(new_location)}))
+		switch {
+		case verdict.Pending:
+			keep_location = true
+			alerts.Suppress(event, verdict.Reason)
+		case verdict.Suppress:
+			alerts.Suppress(event, verdict.Reason)
+		default:
+			err = alerts.Alert(event)
+			if err != nil {
+				log.Err(err).Caller().Msg("")
+				return alerts.Stage("alert", err)
+			}
+			run.Alerted = true
 		}
-		response_body, err = js_handler(path, body)
+	} else {
+		alerts.Unchanged(redirect_target)
+	}
+
+	if endpoint.StatusCode != 0 && endpoint.StatusCode != status_code {
+		event := alert_target(*endpoint)
+		event.Kind = alerts.KindStatusCode
+		event.OldStatusCode = endpoint.StatusCode
+		event.NewStatusCode = status_code
+
+		err = alerts.Alert(event)
 		if err != nil {
 			log.Err(err).Caller().Msg("")
-			return err
+			return alerts.Stage("alert", err)
 		}
+		run.Alerted = true
 	}
 
-	if diff := run_diff(response_body, utils.SplitTerminator(endpoint.ResponseBody, "\n"), endpoint.Url); len(diff) > 0 {
-		err = alerts.Alert(endpoint.Url, diff, "diff")
+	// update endpoint
+	if !unchanged && !keep_baseline {
+		endpoint.PreviousResponseBody = endpoint.ResponseBody
+		endpoint.ResponseBody = bytes.Join(response_body, []byte("\n"))
+	}
+	endpoint.StatusCode = status_code
+	if !keep_location {
+		endpoint.FinalUrl = page.final_url
+		endpoint.Redirects = page.redirects
+	}
+
+	if keep_baseline {
+		// the baseline isn't this body, fetch and extract it again until the change persists
+		endpoint.ETag, endpoint.LastModified, endpoint.ContentHash = "", "", ""
+	} else {
+		endpoint.ETag, endpoint.LastModified, endpoint.ContentHash = page.etag, page.last_modified, hash
+	}
+
+	return alert_err
+}
+
+// diff_body extracts body and alerts on the diff against the baseline,
+// storing a snapshot whenever the baseline moves to it.
+// keep_baseline is true while the change is held back by the dedup rules.
+// A failed alert returns response_body along with its error.
+func diff_body(ctx context.Context, endpoint *models.Endpoint, body []byte, status_code int, run *models.Run) ([][]byte, bool, error) {
+	response_body, err := extract(ctx, body, *endpoint)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return nil, false, alerts.Stage("extract", err)
+	}
+	run.Lines = len(response_body)
+
+	previous_response_body := utils.SplitTerminator(endpoint.ResponseBody, "\n")
+
+	changes := run_diff(response_body, previous_response_body, endpoint.Url)
+	if len(changes) == 0 {
+		alerts.Unchanged(endpoint.Url)
+		// a new status code alone is still a snapshot
+		_, err = record_snapshot(*endpoint, response_body, status_code, "")
 		if err != nil {
 			log.Err(err).Caller().Msg("")
-			return err
 		}
+		return response_body, false, nil
 	}
 
-	if endpoint.StatusCode != 0 && endpoint.StatusCode != status_code {
-		msg := fmt.Sprintf("endpoint: %s\nstatus code has changed: \nprevious: %+v\nnew: %+v\n", endpoint.Url, endpoint.StatusCode, status_code)
-		err = alerts.Alert(msg, "", "basic")
+	run.Diff = true
+	event := alert_target(*endpoint)
+	event.Kind = alerts.KindDiff
+	event.Body = changes
+	event.OldStatusCode = endpoint.StatusCode
+	event.NewStatusCode = status_code
+
+	verdict := alerts.Check(endpoint.Url, alerts.Fingerprint(previous_response_body), alerts.Fingerprint(response_body))
+	if verdict.Pending {
+		// diff against the same baseline until the change persists, it's stored once it does
+		alerts.Suppress(event, verdict.Reason)
+		return response_body, true, nil
+	}
+
+	// the history keeps going without the snapshot, the alert matters more
+	diff_id, err := record_snapshot(*endpoint, response_body, status_code, changes)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+	if diff_id != "" {
+		event.DiffId = diff_id
+		event.Link = fmt.Sprintf("%s/diff/%s", os.Getenv("NGROK_URL"), diff_id)
+	}
+
+	if verdict.Suppress {
+		alerts.Suppress(event, verdict.Reason)
+		return response_body, false, nil
+	}
+
+	err = alerts.Alert(event)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return response_body, false, alerts.Stage("alert", err)
+	}
+	run.Alerted = true
+
+	return response_body, false, nil
+}
+
+// record_snapshot stores changes, the diff of response_body against the baseline,
+// and response_body as a new snapshot of endpoint when it differs from the latest one.
+// Returns the id of the stored diff, empty without changes.
+func record_snapshot(endpoint models.Endpoint, response_body [][]byte, status_code int, changes string) (string, error) {
+	if endpoint.Id == 0 {
+		return "", nil
+	}
+
+	diff_id := ""
+	if len(changes) > 0 {
+		diff_id = uuid.New().String()
+		err := database.DB.CreateDiff(models.Diff{
+			Id:   diff_id,
+			Body: changes,
+			Url:  endpoint.Url,
+		})
 		if err != nil {
-			log.Err(err).Caller().Msg("")
-			return err
+			return "", err
 		}
 	}
 
-	// update endpoint
-	endpoint.PreviousResponseBody = endpoint.ResponseBody
-	endpoint.ResponseBody = bytes.Join(response_body, []byte("\n"))
-	endpoint.StatusCode = status_code
+	body := bytes.Join(response_body, []byte("\n"))
 
-	return nil
+	latest, err := database.DB.GetLatestSnapshot(endpoint.Id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return diff_id, err
+	}
+	if err == nil && latest.Body == string(body) && latest.StatusCode == status_code {
+		return diff_id, nil
+	}
+
+	err = database.DB.CreateSnapshot(models.Snapshot{
+		EndpointId: endpoint.Id,
+		Body:       string(body),
+		StatusCode: status_code,
+		DiffId:     diff_id,
+	})
+	if err != nil {
+		return diff_id, err
+	}
+
+	return diff_id, nil
 }
 
 func run_diff(response_body [][]byte, previous_response_body [][]byte, endpoint string) string {
@@ -140,27 +486,93 @@ func run_diff(response_body [][]byte, previous_response_body [][]byte, endpoint
 	return string(diff.Diff(endpoint, []byte(t2), endpoint, []byte(t1)))
 }
 
-func crawl(endpoint *models.Endpoint) ([]byte, int, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", endpoint.Url, nil)
+// do_request sends the request of endpoint with the cookies of its login session.
+// An expired session is logged in again once.
+func do_request(ctx context.Context, endpoint *models.Endpoint, relogin bool) (*http.Response, error) {
+	timeout := fetch_timeout
+	if endpoint.TimeoutSeconds > 0 {
+		timeout = time.Duration(endpoint.TimeoutSeconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout, CheckRedirect: check_redirect}
+
+	var session models.Session
+	if endpoint.Session != "" {
+		jar, s, err := sessions.Jar(ctx, endpoint.Session)
+		if err != nil {
+			return nil, alerts.Stage("login", err)
+		}
+		client.Jar = jar
+		session = s
+	}
 
+	req, err := build_request(ctx, endpoint)
 	if err != nil {
-		log.Err(err).Caller().Msg("")
-		return []byte{}, 0, err
+		return nil, err
 	}
+	set_conditional(req, *endpoint)
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
 	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.Session != "" && sessions.LoggedOut(session, req.URL.String(), response) {
+		response.Body.Close()
+		if relogin {
+			return nil, alerts.Stage("login", fmt.Errorf("session %s is still logged out after logging in", endpoint.Session))
+		}
+
+		log.Info().
+			Caller().
+			Str("endpoint", endpoint.Url).
+			Str("session", endpoint.Session).
+			Msg("Session expired, logging in again")
+		sessions.Expire(endpoint.Session, client.Jar)
+		return do_request(ctx, endpoint, true)
+	}
+	return response, nil
+}
+
+// crawl fetches endpoint, retrying network errors and 5xx of GET, HEAD and OPTIONS with backoff.
+func crawl(ctx context.Context, endpoint *models.Endpoint) (fetched, error) {
+	var response *http.Response
+	var err error
+
+	retries := fetch_retries
+	if !retried(*endpoint) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err = do_request(ctx, endpoint, false)
+		if attempt >= retries || !retryable(response, err) {
+			break
+		}
+
+		if err == nil {
+			response.Body.Close()
+		}
+		log.Warn().
+			Caller().
+			Err(err).
+			Str("endpoint", endpoint.Url).
+			Int("attempt", attempt+1).
+			Msg("Retrying")
+
+		if err := backoff(ctx, attempt); err != nil {
+			return fetched{}, err
+		}
+	}
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return []byte{}, 0, err
+		return fetched{}, err
 	}
 	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
+	body, err := read_body(response)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return []byte{}, 0, err
+		return fetched{}, err
 	}
 
 	log.Info().
@@ -169,28 +581,35 @@ func crawl(endpoint *models.Endpoint) ([]byte, int, error) {
 		Int("body_length", len(body)).
 		Int("status_code", response.StatusCode).
 		Msg("")
-	return body, response.StatusCode, nil
+	return fetched{
+		body:          body,
+		status_code:   response.StatusCode,
+		final_url:     response.Request.URL.String(),
+		redirects:     redirect_chain(response),
+		etag:          response.Header.Get("ETag"),
+		last_modified: response.Header.Get("Last-Modified"),
+	}, nil
 }
 
-func html_handler(abs_path string, body []byte, extra_args ...string) ([][]byte, error) {
-	out, err := utils.RunPyScript(abs_path, body, extra_args)
+func html_handler(body []byte, selector string) ([][]byte, error) {
+	strs, err := html_strings(body, selector)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
 		return nil, err
 	}
 
-	return process_crawler_output(out), nil
+	return process_crawler_output(join_strings(strs)), nil
 }
 
 // one line per record format
-func js_handler(abs_path string, body []byte, extra_args ...string) ([][]byte, error) {
-	out, err := utils.RunPyScript(abs_path, body, extra_args)
+func js_handler(body []byte, base_url string) ([][]byte, error) {
+	links, err := js_links(body, base_url)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
 		return nil, err
 	}
 
-	return process_crawler_output(out), nil
+	return process_crawler_output(join_strings(links)), nil
 }
 
 func process_crawler_output(out []byte) [][]byte {
@@ -2,7 +2,6 @@ package crawler_test
 
 import (
 	"monitor2/src/crawler"
-	"path/filepath"
 	"testing"
 
   "log"
@@ -16,10 +15,8 @@ func printByteArray(arr [][]byte){
 
 func TestHtmlHandler(t *testing.T){
   body := []byte(`<h1>asdasjdh</h1>`)
-  path, err := filepath.Abs("./scripts/crawl_html.py")
-  if err != nil { t.Fatal(err) }
 
-  res, err := crawler.HtmlHandler(path, body, "h1")
+  res, err := crawler.HtmlHandler(body, "h1")
   if err != nil { t.Fatal(err) }
   if len(res) != 1 {
     t.Fatal()
@@ -28,13 +25,11 @@ func TestHtmlHandler(t *testing.T){
 
 func TestJsHandler(t *testing.T){
   body := []byte(`<script src="asdklasjdklas.com"></script>`)
-  path, err := filepath.Abs("./scripts/crawl_js.py")
-  if err != nil { t.Fatal(err) }
 
-  res, err := crawler.JsHandler(path, body)
+  res, err := crawler.JsHandler(body, "https://example.com/page/")
   if err != nil { t.Fatal(err) }
-  if len(res) != 1 {
-    t.Fatal()
+  if len(res) != 1 || string(res[0]) != "https://example.com/page/asdklasjdklas.com" {
+    t.Fatalf("%q", res)
   }
 }
 
@@ -44,10 +39,8 @@ func TestJsHandlerRemovesDupes(t *testing.T){
     <script src="asdklasjdklas.com"></script>
     <script src="rsdklasjdklas.com"></script>
   `)
-  path, err := filepath.Abs("./scripts/crawl_js.py")
-  if err != nil { t.Fatal(err) }
 
-  res, err := crawler.JsHandler(path, body)
+  res, err := crawler.JsHandler(body, "https://example.com/")
   if err != nil { t.Fatal(err) }
   if len(res) != 2 {
     t.Fatal()
@@ -67,3 +60,53 @@ func TestFilterMatches(t *testing.T){
     t.Fatal()
   }
 }
+
+func TestHtmlHandlerNestedStrings(t *testing.T){
+  body := []byte(`
+    <div class="price"><span>12</span><b>USD</b><!-- old --><script>var a = 1</script></div>
+    <div class="price">15<b>EUR</b></div>
+    <p>ignored</p>
+  `)
+
+  res, err := crawler.HtmlHandler(body, "div.price")
+  if err != nil { t.Fatal(err) }
+  // sorted and deduped by process_crawler_output
+  want := []string{"12", "15", "EUR", "USD"}
+  if len(res) != len(want) {
+    t.Fatalf("%q", res)
+  }
+  for i, el := range res {
+    if string(el) != want[i] { t.Fatalf("%q", res) }
+  }
+}
+
+func TestHtmlHandlerBadSelector(t *testing.T){
+  _, err := crawler.HtmlHandler([]byte(`<h1>a</h1>`), "h1[")
+  if err == nil { t.Fatal() }
+}
+
+func TestJsHandlerResolvesUrls(t *testing.T){
+  body := []byte(`
+    <link rel="modulepreload" href="/static/vendor.js">
+    <script src="/static/app.js"></script>
+    <script src="https://example.com/static/app.js"></script>
+    <script>const m = import("./chunk.js")</script>
+    <img srcset="/img/a.avif 1x, /img/b.png 2x">
+    <a href="javascript:void(0)">x</a>
+  `)
+
+  res, err := crawler.JsHandler(body, "https://example.com/page/")
+  if err != nil { t.Fatal(err) }
+  want := []string{
+    "https://example.com/img/a.avif",
+    "https://example.com/page/chunk.js",
+    "https://example.com/static/app.js",
+    "https://example.com/static/vendor.js",
+  }
+  if len(res) != len(want) {
+    t.Fatalf("%q", res)
+  }
+  for i, el := range res {
+    if string(el) != want[i] { t.Fatalf("%q", res) }
+  }
+}
@@ -1,5 +1,44 @@
 package crawler
 
-var JsHandler = js_handler
+import (
+	"context"
+	models "monitor2/src/db/models"
+	"time"
+)
+
 var HtmlHandler = html_handler
+
+var JsHandler = js_handler
+
 var FilterMatches = filter_matches
+
+var JsonHandler = json_handler
+
+var RegexHandler = regex_handler
+
+var BuildRequest = build_request
+
+// Crawl returns the body, status code, final url and redirect chain of a crawl.
+func Crawl(ctx context.Context, endpoint *models.Endpoint) ([]byte, int, string, []string, error) {
+	page, err := crawl(ctx, endpoint)
+	return page.body, page.status_code, page.final_url, page.redirects, err
+}
+
+// SetFetchLimits replaces the limits read by InitFetch, the returned func restores them.
+func SetFetchLimits(max_body int64, retries int, backoff time.Duration) func() {
+	old_max_body, old_retries, old_backoff := max_body_bytes, fetch_retries, fetch_backoff
+	max_body_bytes, fetch_retries, fetch_backoff = max_body, retries, backoff
+	return func() {
+		max_body_bytes, fetch_retries, fetch_backoff = old_max_body, old_retries, old_backoff
+	}
+}
+
+// RunSingleUnrecorded crawls without storing a Run, endpoints without an id skip the snapshots.
+var RunSingleUnrecorded = run_single
+
+// SetStoreSecret replaces where SealCredentials stores secrets, the returned func restores it.
+func SetStoreSecret(fn func(name string, value string) error) func() {
+	old := store_secret
+	store_secret = fn
+	return func() { store_secret = old }
+}
@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	models "monitor2/src/db/models"
+	"sort"
+	"strings"
+)
+
+// Param is a setting an extractor reads from the endpoint.
+// selector has its own column, every other param is stored in options.
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Extractor turns a response body into the lines that are diffed.
+// Extractors register themselves under a profile name with Register.
+type Extractor interface {
+	Params() []Param
+	// Validate runs before the endpoint is stored, required params are already checked.
+	Validate(params map[string]string) error
+	// Extract returns the lines of body, url is the endpoint url.
+	Extract(ctx context.Context, body []byte, url string, params map[string]string) ([][]byte, error)
+}
+
+var extractors = map[string]Extractor{}
+
+// Register adds an extraction profile, it panics when the name is taken.
+func Register(profile string, extractor Extractor) {
+	if _, ok := extractors[profile]; ok {
+		panic(fmt.Sprintf("profile %s registered twice", profile))
+	}
+	extractors[profile] = extractor
+}
+
+func GetExtractor(profile string) (Extractor, bool) {
+	extractor, ok := extractors[profile]
+	return extractor, ok
+}
+
+// Profiles returns the registered profile names, sorted.
+func Profiles() []string {
+	ret := []string{}
+	for profile := range extractors {
+		ret = append(ret, profile)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Params returns the params of every profile once, for forms and commands.
+func Params() []Param {
+	ret := []Param{}
+	seen := map[string]int{}
+	for _, profile := range Profiles() {
+		for _, param := range extractors[profile].Params() {
+			description := fmt.Sprintf("%s (%s)", param.Description, profile)
+			// profiles sharing a param, like selector, list every meaning
+			if i, ok := seen[param.Name]; ok {
+				ret[i].Description += ", " + description
+				continue
+			}
+			seen[param.Name] = len(ret)
+			// required depends on the profile
+			param.Required = false
+			param.Description = description
+			ret = append(ret, param)
+		}
+	}
+	return ret
+}
+
+// EndpointParams returns the params stored on endpoint.
+func EndpointParams(endpoint models.Endpoint) map[string]string {
+	ret := map[string]string{}
+	for name, value := range endpoint.Options {
+		ret[name] = value
+	}
+	if endpoint.Selector != "" {
+		ret["selector"] = endpoint.Selector
+	}
+	return ret
+}
+
+// SetParams stores every known param returned by value on endpoint,
+// value is usually r.PostFormValue.
+func SetParams(endpoint *models.Endpoint, value func(name string) string) {
+	endpoint.Options = map[string]string{}
+	for _, param := range Params() {
+		v := value(param.Name)
+		if param.Name == "selector" {
+			endpoint.Selector = v
+			continue
+		}
+		if v != "" {
+			endpoint.Options[param.Name] = v
+		}
+	}
+}
+
+func validate_params(endpoint models.Endpoint) error {
+	extractor, ok := GetExtractor(endpoint.Profile)
+	if !ok {
+		return fmt.Errorf("Current profiles: %s", strings.Join(Profiles(), ", "))
+	}
+
+	params := EndpointParams(endpoint)
+	for _, param := range extractor.Params() {
+		if param.Required && params[param.Name] == "" {
+			return fmt.Errorf("Missing '%s' param", param.Name)
+		}
+	}
+	return extractor.Validate(params)
+}
+
+// extract runs the extractor of the endpoint profile.
+func extract(ctx context.Context, body []byte, endpoint models.Endpoint) ([][]byte, error) {
+	extractor, ok := GetExtractor(endpoint.Profile)
+	if !ok {
+		return nil, fmt.Errorf("Unknown profile: %s", endpoint.Profile)
+	}
+	return extractor.Extract(ctx, body, endpoint.Url, EndpointParams(endpoint))
+}
@@ -0,0 +1,86 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"monitor2/src/crawler"
+	models "monitor2/src/db/models"
+	"slices"
+	"testing"
+)
+
+type word_extractor struct{}
+
+func (word_extractor) Params() []crawler.Param {
+	return []crawler.Param{{Name: "word", Description: "Word to look for", Required: true}}
+}
+
+func (word_extractor) Validate(params map[string]string) error {
+	if params["word"] == "bad" {
+		return errors.New("bad word")
+	}
+	return nil
+}
+
+func (word_extractor) Extract(_ context.Context, body []byte, _ string, params map[string]string) ([][]byte, error) {
+	return [][]byte{body}, nil
+}
+
+func init() {
+	crawler.Register("test-word", word_extractor{})
+}
+
+func TestProfilesComeFromRegistry(t *testing.T) {
+	profiles := crawler.Profiles()
+	for _, profile := range []string{"html", "js", "test-word"} {
+		if !slices.Contains(profiles, profile) {
+			t.Fatalf("%s missing from %v", profile, profiles)
+		}
+	}
+}
+
+func TestValidateUsesExtractorParams(t *testing.T) {
+	endpoint := models.Endpoint{Url: "https://example.com", Profile: "test-word"}
+	if err := crawler.Validate(endpoint); err == nil || err.Error() != "Missing 'word' param" {
+		t.Fatal(err)
+	}
+
+	crawler.SetParams(&endpoint, func(name string) string {
+		return map[string]string{"word": "bad", "selector": "h1"}[name]
+	})
+	if endpoint.Options["word"] != "bad" || endpoint.Selector != "h1" {
+		t.Fatalf("%+v", endpoint)
+	}
+	if err := crawler.Validate(endpoint); err == nil || err.Error() != "bad word" {
+		t.Fatal(err)
+	}
+
+	endpoint.Options["word"] = "good"
+	if err := crawler.Validate(endpoint); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRejectsUnknownProfile(t *testing.T) {
+	err := crawler.Validate(models.Endpoint{Url: "https://example.com", Profile: "nope"})
+	if err == nil {
+		t.Fatal()
+	}
+}
+
+func TestValidateHtmlSelector(t *testing.T) {
+	endpoint := models.Endpoint{Url: "https://example.com", Profile: "html"}
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal()
+	}
+
+	endpoint.Selector = "h1["
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal()
+	}
+
+	endpoint.Selector = "h1"
+	if err := crawler.Validate(endpoint); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"monitor2/src/alerts"
+	models "monitor2/src/db/models"
+	"monitor2/src/sessions"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultFetchTimeout = 30 * time.Second
+	DefaultMaxBodyBytes = 10 << 20
+	DefaultFetchRetries = 2
+	DefaultFetchBackoff = 500 * time.Millisecond
+	// like net/http, which stops after 10 redirects
+	max_redirects = 10
+)
+
+// fetch limits, see InitFetch
+var (
+	fetch_timeout  = DefaultFetchTimeout
+	max_body_bytes = int64(DefaultMaxBodyBytes)
+	fetch_retries  = DefaultFetchRetries
+	fetch_backoff  = DefaultFetchBackoff
+)
+
+// InitFetch reads FETCH_TIMEOUT_SECONDS, the default of endpoints without their own timeout,
+// FETCH_MAX_BODY_BYTES, FETCH_RETRIES and FETCH_BACKOFF_MS.
+func InitFetch() {
+	fetch_timeout = time.Duration(int_from_env("FETCH_TIMEOUT_SECONDS", int(DefaultFetchTimeout/time.Second))) * time.Second
+	max_body_bytes = int64(int_from_env("FETCH_MAX_BODY_BYTES", DefaultMaxBodyBytes))
+	fetch_retries = int_from_env("FETCH_RETRIES", DefaultFetchRetries)
+	fetch_backoff = time.Duration(int_from_env("FETCH_BACKOFF_MS", int(DefaultFetchBackoff/time.Millisecond))) * time.Millisecond
+	// logins follow the same limits as the crawls they're for
+	sessions.SetLimits(fetch_timeout, max_body_bytes, max_redirects)
+}
+
+func int_from_env(env string, fallback int) int {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s: %s", env, raw)
+		return fallback
+	}
+	return n
+}
+
+// fetched is the response of a crawl.
+type fetched struct {
+	body        []byte
+	status_code int
+	// url the redirects ended at
+	final_url string
+	// every url redirected to, in order
+	redirects []string
+	// validators sent back on the next crawl
+	etag          string
+	last_modified string
+}
+
+var ErrBodyTooLarge = errors.New("response body is too large")
+
+// retryable is true for errors and statuses that are likely gone on the next try:
+// network errors and 5xx. Login failures and cancelled jobs aren't retried.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		var stage_err *alerts.StageError
+		return !errors.As(err, &stage_err) && !errors.Is(err, context.Canceled)
+	}
+	return response.StatusCode >= 500
+}
+
+// methods without side effects, a POST that timed out or failed with a 5xx
+// may still have been applied and isn't sent twice
+var retried_methods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+func retried(endpoint models.Endpoint) bool {
+	return endpoint.Method == "" || contains(retried_methods, endpoint.Method)
+}
+
+// backoff waits fetch_backoff * 2^attempt, or until ctx is done.
+func backoff(ctx context.Context, attempt int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(fetch_backoff << attempt):
+		return nil
+	}
+}
+
+// read_body reads at most max_body_bytes of response.
+func read_body(response *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(response.Body, max_body_bytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max_body_bytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, max_body_bytes)
+	}
+	return body, nil
+}
+
+// set_conditional asks for the body only if it changed since the stored response.
+// Other methods than GET and HEAD aren't cached by servers.
+func set_conditional(req *http.Request, endpoint models.Endpoint) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return
+	}
+	if endpoint.ETag != "" {
+		req.Header.Set("If-None-Match", endpoint.ETag)
+	}
+	if endpoint.LastModified != "" {
+		req.Header.Set("If-Modified-Since", endpoint.LastModified)
+	}
+}
+
+// content_hash identifies a raw body, equal bodies are extracted to equal lines.
+func content_hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// redirect_chain returns the urls response was redirected through, in order.
+func redirect_chain(response *http.Response) []string {
+	chain := []string{}
+	for req := response.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+	return chain
+}
+
+// without_query strips the query and fragment of a url.
+func without_query(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	return u.String()
+}
+
+func check_redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= max_redirects {
+		return fmt.Errorf("stopped after %d redirects", max_redirects)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monitor2/src/alerts"
+	"monitor2/src/crawler"
+	models "monitor2/src/db/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlRetriesServerErrors(t *testing.T) {
+	defer crawler.SetFetchLimits(crawler.DefaultMaxBodyBytes, 2, time.Millisecond)()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL, Profile: "js"}
+	body, status_code, _, _, err := crawler.Crawl(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || status_code != 200 || attempts != 3 {
+		t.Fatal(string(body), status_code, attempts)
+	}
+}
+
+func TestCrawlGivesUpAfterRetries(t *testing.T) {
+	defer crawler.SetFetchLimits(crawler.DefaultMaxBodyBytes, 1, time.Millisecond)()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL, Profile: "js"}
+	_, status_code, _, _, err := crawler.Crawl(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status_code != http.StatusServiceUnavailable || attempts != 2 {
+		t.Fatal(status_code, attempts)
+	}
+}
+
+func TestCrawlDoesntRetryPost(t *testing.T) {
+	defer crawler.SetFetchLimits(crawler.DefaultMaxBodyBytes, 2, time.Millisecond)()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL, Profile: "js", Method: "POST", RequestBody: "a=1"}
+	_, status_code, _, _, err := crawler.Crawl(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status_code != http.StatusBadGateway || attempts != 1 {
+		t.Fatal(status_code, attempts)
+	}
+}
+
+func TestCrawlBodyTooLarge(t *testing.T) {
+	defer crawler.SetFetchLimits(8, 0, time.Millisecond)()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 9)))
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL, Profile: "js"}
+	_, _, _, _, err := crawler.Crawl(context.Background(), &endpoint)
+	if !errors.Is(err, crawler.ErrBodyTooLarge) {
+		t.Fatal(err)
+	}
+}
+
+func TestCrawlRecordsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL + "/old", Profile: "js"}
+	body, _, final_url, redirects, err := crawler.Crawl(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "new" || final_url != server.URL+"/new" {
+		t.Fatal(string(body), final_url)
+	}
+	if !slices.Equal(redirects, []string{server.URL + "/moved", server.URL + "/new"}) {
+		t.Fatal(redirects)
+	}
+}
+
+func TestRunSingleSendsValidators(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("<h1>v1</h1>"))
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL + "/validators", Profile: "html", Selector: "h1"}
+	run := models.Run{}
+	err := crawler.RunSingleUnrecorded(context.Background(), &endpoint, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.ETag != `"v1"` || endpoint.ContentHash == "" || string(endpoint.ResponseBody) != "v1" {
+		t.Fatalf("%+v", endpoint)
+	}
+
+	run = models.Run{}
+	err = crawler.RunSingleUnrecorded(context.Background(), &endpoint, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.StatusCode != http.StatusNotModified || run.Lines != 0 || requests != 2 {
+		t.Fatalf("%+v %d", run, requests)
+	}
+	if endpoint.StatusCode != 200 || string(endpoint.ResponseBody) != "v1" {
+		t.Fatalf("%+v", endpoint)
+	}
+}
+
+func TestRunSingleSkipsIdenticalBodies(t *testing.T) {
+	body := "<h1>v1</h1>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL + "/identical", Profile: "html", Selector: "h1"}
+	run := models.Run{}
+	err := crawler.RunSingleUnrecorded(context.Background(), &endpoint, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Lines != 1 {
+		t.Fatalf("%+v", run)
+	}
+
+	run = models.Run{}
+	err = crawler.RunSingleUnrecorded(context.Background(), &endpoint, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// extraction was skipped
+	if run.Lines != 0 || run.Diff || string(endpoint.ResponseBody) != "v1" {
+		t.Fatalf("%+v %+v", run, endpoint)
+	}
+
+	body = "<h1>v2</h1>"
+	run = models.Run{}
+	err = crawler.RunSingleUnrecorded(context.Background(), &endpoint, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run.Diff || string(endpoint.ResponseBody) != "v2" {
+		t.Fatalf("%+v %+v", run, endpoint)
+	}
+}
+
+type redirectNotifier struct {
+	events []alerts.Event
+}
+
+func (n *redirectNotifier) Name() string { return "redirects" }
+
+func (n *redirectNotifier) Notify(event alerts.Event) error {
+	if event.Kind == alerts.KindRedirect {
+		n.events = append(n.events, event)
+	}
+	return nil
+}
+
+func TestRedirectAlertIgnoresQuery(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+	notifier := &redirectNotifier{}
+	alerts.Register(notifier)
+
+	runs := 0
+	target := "/cdn/app.js"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		http.Redirect(w, r, fmt.Sprintf("%s?sig=%d", target, runs), http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<h1>app</h1>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL + "/start", Profile: "html", Selector: "h1"}
+	for i := 0; i < 2; i++ {
+		err := crawler.RunSingleUnrecorded(context.Background(), &endpoint, &models.Run{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.events) != 0 || endpoint.FinalUrl != server.URL+"/cdn/app.js?sig=2" {
+		t.Fatal(notifier.events, endpoint.FinalUrl)
+	}
+
+	target = "/moved/app.js"
+	err := crawler.RunSingleUnrecorded(context.Background(), &endpoint, &models.Run{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.events) != 1 || notifier.events[0].NewLocation != server.URL+"/moved/app.js?sig=3" {
+		t.Fatal(notifier.events)
+	}
+}
+
+type failingNotifier struct {
+	sent int
+}
+
+func (n *failingNotifier) Name() string { return "failing" }
+
+func (n *failingNotifier) Notify(event alerts.Event) error {
+	n.sent++
+	return errors.New("notifier down")
+}
+
+func TestFailedAlertMovesBaseline(t *testing.T) {
+	alerts.Reset()
+	defer alerts.Reset()
+	notifier := &failingNotifier{}
+	alerts.Register(notifier)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<h1>new</h1>"))
+	}))
+	defer server.Close()
+
+	endpoint := models.Endpoint{Url: server.URL, Profile: "html", Selector: "h1", ResponseBody: []byte("old"), StatusCode: 200}
+	err := crawler.RunSingleUnrecorded(context.Background(), &endpoint, &models.Run{})
+	if err == nil || string(endpoint.ResponseBody) != "new" {
+		t.Fatal(err, string(endpoint.ResponseBody))
+	}
+
+	// the same change isn't sent again
+	err = crawler.RunSingleUnrecorded(context.Background(), &endpoint, &models.Run{})
+	if err != nil || notifier.sent != 1 {
+		t.Fatal(err, notifier.sent)
+	}
+}
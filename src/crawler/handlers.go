@@ -1,35 +1,26 @@
 package crawler
 
 import (
+	"errors"
 	"fmt"
+	"monitor2/src/alerts"
 	database "monitor2/src/db"
 	models "monitor2/src/db/models"
+	"monitor2/src/schedule"
+	"monitor2/utils"
 	"net/http"
 	"strconv"
+	"strings"
 	"html/template"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
 func RunEndpoint(w http.ResponseWriter, r *http.Request) {
 	url := r.PostFormValue("url")
 
-	if len(url) == 0 {
-		fmt.Fprintf(w, "Missing 'url' param")
-		return
-	}
-
-	endpoint, err := database.DB.GetEndpointByUrl(url)
-	if err != nil {
-		fmt.Fprint(w, err)
-		return
-	}
-
-	err = RunSingle(&endpoint)
-	if err != nil {
-		fmt.Fprint(w, err)
-		return
-	}
-
-	err = database.DB.UpdateEndpointByUrl(endpoint, true)
+	err := Run(url)
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
@@ -41,63 +32,46 @@ func CreateEndpoint(w http.ResponseWriter, r *http.Request) {
   err := r.ParseForm()
   if err != nil { fmt.Fprint(w, err) }
 
-  url := r.PostFormValue("url")
-  // validate that it is a valid html selector
-	selector := r.PostFormValue("selector")
-	profile := r.PostFormValue("profile")
-
-	if len(profile) == 0 {
-		fmt.Fprintf(w, "Missing 'profile' param")
-		return
-	}
-
-	if !(profile == "js" || profile == "html") {
-		fmt.Fprintf(w, "Current profiles: js, html")
-		return
-	}
-
-	if profile == "html" && len(selector) == 0 {
-		fmt.Fprintf(w, "Missing 'selector' param")
-		return
-	}
-
-	if len(url) == 0 {
-		fmt.Fprintf(w, "Missing 'url' param")
-		return
-	}
-
 	endpoint := models.Endpoint{
-		Url:      url,
-		Selector: selector,
-		Profile:  profile,
+		Url:          r.PostFormValue("url"),
+		Profile:      r.PostFormValue("profile"),
+		Tags:         r.PostFormValue("tags"),
+		ScheduleCron: r.PostFormValue("schedule_cron"),
+		Timezone:     r.PostFormValue("timezone"),
 	}
 
-	err = database.DB.CreateEndpoint(endpoint)
-	if err != nil {
-		fmt.Fprintf(w, "on create: %+v\n", err)
-		return
-	}
+	SetParams(&endpoint, r.PostFormValue)
 
-	err = RunSingle(&endpoint)
+	err = request_spec_from_form(r, &endpoint)
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
 	}
 
-	err = database.DB.UpdateEndpointByUrl(endpoint, true)
+	if r.PostFormValue("schedule_hours") != "" {
+		endpoint.ScheduleHours, err = strconv.Atoi(r.PostFormValue("schedule_hours"))
+		if err != nil {
+			fmt.Fprint(w, "Invalid schedule_hours value")
+			return
+		}
+	}
+
+	err = Create(endpoint)
 	if err != nil {
-		fmt.Fprintf(w, "on update: %+v\n", err)
+		fmt.Fprint(w, err)
 		return
 	}
-	fmt.Fprintf(w, "Done: %+v\n", url)
+	fmt.Fprintf(w, "Done: %+v\n", endpoint.Url)
 }
 
 func UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
 	url := r.PostFormValue("url")
 	scheduleHoursRaw := r.PostFormValue("schedule_hours")
-	selector := r.PostFormValue("selector")
 	profile := r.PostFormValue("profile")
 	deletedRaw := r.PostFormValue("deleted")
+	tags := r.PostFormValue("tags")
+	scheduleCron := r.PostFormValue("schedule_cron")
+	timezone := r.PostFormValue("timezone")
 
 	if url == "" {
 		fmt.Fprint(w, "All fields are required")
@@ -105,7 +79,7 @@ func UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
 	}
 
 	scheduleHours, err := strconv.Atoi(scheduleHoursRaw)
-	if err != nil {
+	if err != nil || scheduleHours < 1 {
 		fmt.Fprint(w, "Invalid schedule_hours value")
 		return
 	}
@@ -119,12 +93,59 @@ func UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	current, err := database.DB.GetEndpointByUrl(url)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// the new schedule counts from the last run
+	from := time.Now()
+	if current.LastRunAt != nil {
+		from = *current.LastRunAt
+	}
+
+	nextRunAt, err := schedule.Next(scheduleHours, scheduleCron, timezone, from)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
 	endpoint := models.Endpoint{
 		Url:                  url,
 		ScheduleHours:        scheduleHours,
-		Selector:             selector,
 		Profile:              profile,
 		Deleted:              deleted,
+		Tags:                 tags,
+		NextRunAt:            nextRunAt,
+		ScheduleCron:         scheduleCron,
+		Timezone:             timezone,
+	}
+
+	SetParams(&endpoint, r.PostFormValue)
+
+	err = request_spec_from_form(r, &endpoint)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+	// masked values are sent back as they were shown
+	KeepMasked(endpoint.Headers, current.Headers)
+	KeepMasked(endpoint.Cookies, current.Cookies)
+	if endpoint.RequestBody == Mask {
+		endpoint.RequestBody = current.RequestBody
+	}
+
+	err = Validate(endpoint)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	_, err = SealCredentials(&endpoint)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
 	}
 
 	err = database.DB.UpdateEndpointByUrl(endpoint, false)
@@ -136,6 +157,34 @@ func UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/crawl", 303)
 }
 
+// request_spec_from_form reads method, headers (one "Name: value" per line),
+// request_body, cookies ("a=1; b=2") and the login session name.
+func request_spec_from_form(r *http.Request, endpoint *models.Endpoint) error {
+	var err error
+	endpoint.Method = strings.ToUpper(strings.TrimSpace(r.PostFormValue("method")))
+	endpoint.RequestBody = r.PostFormValue("request_body")
+	endpoint.Session = strings.TrimSpace(r.PostFormValue("session"))
+
+	endpoint.Headers, err = ParseHeaders(r.PostFormValue("headers"))
+	if err != nil {
+		return err
+	}
+
+	endpoint.Cookies, err = ParseCookies(r.PostFormValue("cookies"))
+	if err != nil {
+		return err
+	}
+
+	endpoint.TimeoutSeconds = 0
+	if raw := r.PostFormValue("timeout_seconds"); raw != "" {
+		endpoint.TimeoutSeconds, err = strconv.Atoi(raw)
+		if err != nil || endpoint.TimeoutSeconds < 0 {
+			return errors.New("Invalid timeout_seconds value")
+		}
+	}
+	return nil
+}
+
 func DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
 	url := r.PostFormValue("url")
 	if len(url) == 0 {
@@ -156,20 +205,158 @@ func DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Rows affected: %+v\n", rows_affected)
 }
 
+type endpoint_view struct {
+	models.Endpoint
+	Routes []models.Route
+	// next run in the timezone of the endpoint
+	NextRun string
+	// choices of the edit form, from the extractor registry
+	Profiles []string
+	Params   []param_view
+	// request spec with secret values masked
+	Headers     string
+	Cookies     string
+	RequestBody string
+}
+
+type param_view struct {
+	Param
+	Value string
+}
+
+func param_views(endpoint models.Endpoint) []param_view {
+	values := EndpointParams(endpoint)
+	ret := []param_view{}
+	for _, param := range Params() {
+		ret = append(ret, param_view{Param: param, Value: values[param.Name]})
+	}
+	return ret
+}
+
 func Endpoints(w http.ResponseWriter, r *http.Request) {
-	repos, err := database.DB.GetAllEndpoints()
+	endpoints, err := database.DB.GetAllEndpoints()
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
 	}
 
+	routes, err := database.DB.GetAllRoutes()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	views := []endpoint_view{}
+	for _, endpoint := range endpoints {
+		views = append(views, endpoint_view{
+			Endpoint:    endpoint,
+			Routes:      alerts.RoutesFor(routes, alert_target(endpoint)),
+			NextRun:     schedule.Format(endpoint.NextRunAt, endpoint.Timezone),
+			Profiles:    Profiles(),
+			Params:      param_views(endpoint),
+			Headers:     FormatHeaders(endpoint.Headers, true),
+			Cookies:     FormatCookies(endpoint.Cookies, true),
+			RequestBody: FormatBody(endpoint.RequestBody, true),
+		})
+	}
+
 	template, err := template.ParseFiles("static/templates/endpoints.html")
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
 	}
 
-	err = template.ExecuteTemplate(w, "endpoints.html", repos)
+	err = template.ExecuteTemplate(w, "endpoints.html", views)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+// History shows the snapshot timeline of an endpoint.
+func History(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		fmt.Fprint(w, "Invalid id value")
+		return
+	}
+
+	endpoint, err := database.DB.GetEndpointById(id)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	snapshots, err := database.DB.GetSnapshots(id)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/history.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "history.html", map[string]any{
+		"Endpoint":  endpoint,
+		"Snapshots": snapshots,
+	})
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+// Compare diffs two snapshots of an endpoint, from and to are snapshot ids.
+func Compare(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		fmt.Fprint(w, "Invalid id value")
+		return
+	}
+
+	from, err := strconv.Atoi(r.FormValue("from"))
+	if err != nil {
+		fmt.Fprint(w, "Invalid from value")
+		return
+	}
+
+	to, err := strconv.Atoi(r.FormValue("to"))
+	if err != nil {
+		fmt.Fprint(w, "Invalid to value")
+		return
+	}
+
+	old, err := database.DB.GetSnapshot(from)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	new, err := database.DB.GetSnapshot(to)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if old.EndpointId != id || new.EndpointId != id {
+		fmt.Fprint(w, "Snapshots don't belong to this endpoint")
+		return
+	}
+
+	old_name := old.CreatedAt.Format("2006-01-02 15:04:05")
+	new_name := new.CreatedAt.Format("2006-01-02 15:04:05")
+	body := utils.Diff(old_name, []byte(old.Body), new_name, []byte(new.Body))
+
+	template, err := template.ParseFiles("static/templates/diff.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "diff.html", map[string]string{"body": string(body)})
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// html_strings returns the text strings of every element matching selector,
+// like bs4's el.strings. Comments are skipped, and so are script and style
+// contents unless the selected element is the script or style itself.
+func html_strings(body []byte, selector string) ([]string, error) {
+	sel, err := cascadia.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, el := range cascadia.QueryAll(doc, sel) {
+		ret = append(ret, text_nodes(el, true)...)
+	}
+	return ret, nil
+}
+
+func text_nodes(n *html.Node, selected bool) []string {
+	switch n.Type {
+	case html.TextNode:
+		return []string{n.Data}
+	case html.ElementNode:
+		if !selected && (n.Data == "script" || n.Data == "style" || n.Data == "template") {
+			return nil
+		}
+	case html.CommentNode:
+		return nil
+	}
+
+	ret := []string{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ret = append(ret, text_nodes(c, false)...)
+	}
+	return ret
+}
+
+func join_strings(strs []string) []byte {
+	return []byte(strings.Join(strs, "\n"))
+}
+
+func init() {
+	Register("html", html_extractor{})
+}
+
+// html_extractor returns the text of the elements matching selector.
+type html_extractor struct{}
+
+func (html_extractor) Params() []Param {
+	return []Param{{Name: "selector", Description: "CSS selector", Required: true}}
+}
+
+func (html_extractor) Validate(params map[string]string) error {
+	_, err := cascadia.Parse(params["selector"])
+	if err != nil {
+		return fmt.Errorf("Invalid 'selector' param: %w", err)
+	}
+	return nil
+}
+
+func (html_extractor) Extract(_ context.Context, body []byte, _ string, params map[string]string) ([][]byte, error) {
+	return html_handler(body, params["selector"])
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// import("./chunk.js") in inline scripts
+var dynamic_import = regexp.MustCompile("import\\s*\\(\\s*[\"'`]([^\"'`]+)[\"'`]\\s*\\)")
+
+// schemes that never point to an asset
+var skipped_schemes = []string{"data:", "javascript:", "mailto:", "tel:", "blob:"}
+
+// js_links returns every src/href, srcset candidate and dynamic import in body,
+// resolved against base_url so relative and absolute links to the same file match.
+// A <base href> in the document takes precedence over base_url.
+func js_links(body []byte, base_url string) ([]string, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(base_url)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []string{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "base" {
+				if href, ok := attr(n, "href"); ok {
+					if ref, err := base.Parse(strings.TrimSpace(href)); err == nil {
+						base = ref
+					}
+				}
+			} else if src, ok := attr(n, "src"); ok {
+				links = append(links, src)
+			} else if href, ok := attr(n, "href"); ok {
+				links = append(links, href)
+			}
+
+			if srcset, ok := attr(n, "srcset"); ok {
+				links = append(links, srcset_urls(srcset)...)
+			}
+
+			if n.Data == "script" {
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type != html.TextNode {
+						continue
+					}
+					for _, match := range dynamic_import.FindAllStringSubmatch(c.Data, -1) {
+						links = append(links, match[1])
+					}
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	ret := []string{}
+	for _, link := range links {
+		link = strings.TrimSpace(link)
+		if link == "" || has_skipped_scheme(link) {
+			continue
+		}
+
+		ref, err := base.Parse(link)
+		if err != nil {
+			// keep what the page has, it is still worth diffing
+			ret = append(ret, link)
+			continue
+		}
+		ret = append(ret, ref.String())
+	}
+	return ret, nil
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// "a.png 1x, b.png 2x" -> a.png, b.png
+func srcset_urls(srcset string) []string {
+	ret := []string{}
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			ret = append(ret, fields[0])
+		}
+	}
+	return ret
+}
+
+func has_skipped_scheme(link string) bool {
+	lower := strings.ToLower(link)
+	for _, scheme := range skipped_schemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	Register("js", js_extractor{})
+}
+
+// js_extractor returns the script and asset links of the page.
+type js_extractor struct{}
+
+func (js_extractor) Params() []Param { return nil }
+
+func (js_extractor) Validate(map[string]string) error { return nil }
+
+func (js_extractor) Extract(_ context.Context, body []byte, url string, _ map[string]string) ([][]byte, error) {
+	return js_handler(body, url)
+}
@@ -0,0 +1,248 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("json", json_extractor{})
+}
+
+// json_extractor flattens the values matching a JSONPath into "path = value" lines.
+type json_extractor struct{}
+
+func (json_extractor) Params() []Param {
+	return []Param{{Name: "selector", Description: "JSONPath like $.flags[*].name, the whole document when empty"}}
+}
+
+func (json_extractor) Validate(params map[string]string) error {
+	_, err := parse_json_path(params["selector"])
+	if err != nil {
+		return fmt.Errorf("Invalid 'selector' param: %w", err)
+	}
+	return nil
+}
+
+func (json_extractor) Extract(_ context.Context, body []byte, _ string, params map[string]string) ([][]byte, error) {
+	return json_handler(body, params["selector"])
+}
+
+func json_handler(body []byte, selector string) ([][]byte, error) {
+	lines, err := json_lines(body, selector)
+	if err != nil {
+		return nil, err
+	}
+	return process_crawler_output(join_strings(lines)), nil
+}
+
+// json_lines returns one "path = value" line per leaf under the matches of selector.
+func json_lines(body []byte, selector string) ([]string, error) {
+	steps, err := parse_json_path(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keeps 1.0 and 10000000000 as they were sent
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	matches := []json_node{{path: "$", value: doc}}
+	for _, step := range steps {
+		matches = step.apply(matches)
+	}
+
+	ret := []string{}
+	for _, match := range matches {
+		ret = append(ret, flatten_json(match)...)
+	}
+	return ret, nil
+}
+
+type json_node struct {
+	path  string
+	value any
+}
+
+type json_step struct {
+	// recursive descent, ..key
+	recursive bool
+	// object key, "*" for every key and index
+	key string
+	// array index, used when is_index is set
+	index    int
+	is_index bool
+}
+
+func (step json_step) apply(nodes []json_node) []json_node {
+	if step.recursive {
+		nodes = descendants(nodes)
+	}
+
+	ret := []json_node{}
+	for _, node := range nodes {
+		switch value := node.value.(type) {
+		case map[string]any:
+			if step.is_index {
+				continue
+			}
+			for _, key := range sorted_keys(value) {
+				if step.key == "*" || step.key == key {
+					ret = append(ret, json_node{path: json_key_path(node.path, key), value: value[key]})
+				}
+			}
+		case []any:
+			if step.is_index {
+				i := step.index
+				if i < 0 {
+					i += len(value)
+				}
+				if i >= 0 && i < len(value) {
+					ret = append(ret, json_node{path: fmt.Sprintf("%s[%d]", node.path, i), value: value[i]})
+				}
+			} else if step.key == "*" {
+				for i, el := range value {
+					ret = append(ret, json_node{path: fmt.Sprintf("%s[%d]", node.path, i), value: el})
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// the nodes and everything below them
+func descendants(nodes []json_node) []json_node {
+	ret := []json_node{}
+	for _, node := range nodes {
+		ret = append(ret, node)
+		children := json_step{key: "*"}.apply([]json_node{node})
+		ret = append(ret, descendants(children)...)
+	}
+	return ret
+}
+
+// leaves as "path = value", keys sorted so the lines are stable
+func flatten_json(node json_node) []string {
+	switch value := node.value.(type) {
+	case map[string]any:
+		if len(value) == 0 {
+			return []string{node.path + " = {}"}
+		}
+	case []any:
+		if len(value) == 0 {
+			return []string{node.path + " = []"}
+		}
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(value))
+		}
+		return []string{fmt.Sprintf("%s = %s", node.path, encoded)}
+	}
+
+	ret := []string{}
+	for _, child := range (json_step{key: "*"}).apply([]json_node{node}) {
+		ret = append(ret, flatten_json(child)...)
+	}
+	return ret
+}
+
+func sorted_keys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var json_identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func json_key_path(path string, key string) string {
+	if json_identifier.MatchString(key) {
+		return path + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return fmt.Sprintf("%s[%s]", path, quoted)
+}
+
+// parse_json_path parses a JSONPath subset: $, .key, ..key, .*, [n], [-n], [*], ["key"].
+// The leading $ is optional so jq style .a.b[0] works too.
+func parse_json_path(path string) ([]json_step, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	steps := []json_step{}
+	for len(path) > 0 {
+		switch {
+		case strings.HasPrefix(path, ".."):
+			key, rest := read_json_key(path[2:])
+			if key == "" {
+				return nil, errors.New("expected a key after ..")
+			}
+			steps = append(steps, json_step{recursive: true, key: key})
+			path = rest
+		case path[0] == '.':
+			key, rest := read_json_key(path[1:])
+			if key == "" {
+				// jq's identity
+				if rest == "" && len(steps) == 0 {
+					return steps, nil
+				}
+				return nil, fmt.Errorf("expected a key at %q", path)
+			}
+			steps = append(steps, json_step{key: key})
+			path = rest
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, errors.New("unclosed [")
+			}
+			step, err := parse_json_bracket(path[1:end])
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+			path = path[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", path)
+		}
+	}
+	return steps, nil
+}
+
+func read_json_key(path string) (string, string) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		return path, ""
+	}
+	return path[:end], path[end:]
+}
+
+func parse_json_bracket(inner string) (json_step, error) {
+	inner = strings.TrimSpace(inner)
+	if inner == "*" {
+		return json_step{key: "*"}, nil
+	}
+
+	if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+		return json_step{key: inner[1 : len(inner)-1]}, nil
+	}
+
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return json_step{}, fmt.Errorf("invalid index %q", inner)
+	}
+	return json_step{index: index, is_index: true}, nil
+}
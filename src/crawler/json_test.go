@@ -0,0 +1,82 @@
+package crawler_test
+
+import (
+	"monitor2/src/crawler"
+	"testing"
+)
+
+func lines(res [][]byte) []string {
+	ret := []string{}
+	for _, el := range res {
+		ret = append(ret, string(el))
+	}
+	return ret
+}
+
+func expectLines(t *testing.T, res [][]byte, want []string) {
+	t.Helper()
+	got := lines(res)
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+var flags = []byte(`{
+  "version": "1.2.0",
+  "flags": [
+    {"name": "beta", "enabled": true, "rollout": 0.5},
+    {"name": "new-ui", "enabled": false, "rollout": 1.0}
+  ],
+  "meta": {"region.eu": {"build": 10000000000}, "empty": {}}
+}`)
+
+func TestJsonHandlerFlattensDocument(t *testing.T) {
+	res, err := crawler.JsonHandler(flags, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{
+		`$.flags[0].enabled = true`,
+		`$.flags[0].name = "beta"`,
+		`$.flags[0].rollout = 0.5`,
+		`$.flags[1].enabled = false`,
+		`$.flags[1].name = "new-ui"`,
+		`$.flags[1].rollout = 1.0`,
+		`$.meta.empty = {}`,
+		`$.meta["region.eu"].build = 10000000000`,
+		`$.version = "1.2.0"`,
+	})
+}
+
+func TestJsonHandlerSelectors(t *testing.T) {
+	cases := map[string][]string{
+		"$.flags[*].name":     {`$.flags[0].name = "beta"`, `$.flags[1].name = "new-ui"`},
+		".flags[-1].enabled":  {`$.flags[1].enabled = false`},
+		"$..build":            {`$.meta["region.eu"].build = 10000000000`},
+		`$.meta["region.eu"]`: {`$.meta["region.eu"].build = 10000000000`},
+		"$.missing":           {},
+	}
+	for selector, want := range cases {
+		res, err := crawler.JsonHandler(flags, selector)
+		if err != nil {
+			t.Fatal(selector, err)
+		}
+		expectLines(t, res, want)
+	}
+}
+
+func TestJsonHandlerInvalid(t *testing.T) {
+	if _, err := crawler.JsonHandler([]byte(`<html>`), ""); err == nil {
+		t.Fatal("expected a json error")
+	}
+	for _, selector := range []string{"$.flags[", "$.flags[x]", "flags", "$.."} {
+		if _, err := crawler.JsonHandler(flags, selector); err == nil {
+			t.Fatal(selector)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"monitor2/utils"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	Register("regex", regex_extractor{})
+}
+
+// regex_extractor returns every match of pattern in the raw body.
+type regex_extractor struct{}
+
+func (regex_extractor) Params() []Param {
+	return []Param{
+		{Name: "pattern", Description: "Go regular expression", Required: true},
+		{Name: "format", Description: "line per match using named groups, e.g. ${version}-${build}, the whole match when empty"},
+		{Name: "flags", Description: "i for case-insensitive, m for multiline, s to let . match newlines"},
+	}
+}
+
+func (regex_extractor) Validate(params map[string]string) error {
+	_, err := compile_pattern(params["pattern"], params["flags"])
+	if err != nil {
+		return fmt.Errorf("Invalid 'pattern' param: %w", err)
+	}
+	return nil
+}
+
+func (regex_extractor) Extract(_ context.Context, body []byte, _ string, params map[string]string) ([][]byte, error) {
+	return regex_handler(body, params["pattern"], params["flags"], params["format"])
+}
+
+func regex_handler(body []byte, pattern string, flags string, format string) ([][]byte, error) {
+	re, err := compile_pattern(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// not process_crawler_output, its asset filter is meant for the js profile
+	lines := [][]byte{}
+	for _, match := range re.FindAllSubmatchIndex(body, -1) {
+		line := body[match[0]:match[1]]
+		if format != "" {
+			line = re.Expand(nil, []byte(format), body, match)
+		}
+		// patterns like a* also match the empty string between characters
+		if len(line) == 0 {
+			continue
+		}
+		// a match spanning lines stays one line of the diff
+		lines = append(lines, bytes.ReplaceAll(line, []byte("\n"), []byte(`\n`)))
+	}
+	utils.SortBytes(lines)
+	return utils.CompactBytes(lines), nil
+}
+
+func compile_pattern(pattern string, flags string) (*regexp.Regexp, error) {
+	for _, flag := range flags {
+		if !strings.ContainsRune("ims", flag) {
+			return nil, fmt.Errorf("unknown flag %q, use i, m or s", flag)
+		}
+	}
+
+	if flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", flags, pattern)
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,75 @@
+package crawler_test
+
+import (
+	"monitor2/src/crawler"
+	models "monitor2/src/db/models"
+	"testing"
+)
+
+var page = []byte(`<script>
+window.APP_VERSION = "4.2.1"; window.BUILD = "abc123";
+</script>
+<footer>Version 4.2.1</footer>`)
+
+func TestRegexHandlerWholeMatch(t *testing.T) {
+	res, err := crawler.RegexHandler(page, `version \d+\.\d+\.\d+`, "i", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{"Version 4.2.1"})
+}
+
+func TestRegexHandlerNamedGroups(t *testing.T) {
+	res, err := crawler.RegexHandler(page, `APP_VERSION = "(?P<version>[^"]+)"; window.BUILD = "(?P<build>[^"]+)"`, "", "${version}+${build}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{"4.2.1+abc123"})
+}
+
+func TestRegexHandlerMultiline(t *testing.T) {
+	res, err := crawler.RegexHandler(page, `^<\w+>`, "m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{"<footer>", "<script>"})
+}
+
+func TestRegexHandlerKeepsAssetNames(t *testing.T) {
+	body := []byte(`<link href="/static/app.css"><img src="/logo.svg">`)
+	res, err := crawler.RegexHandler(body, `/[\w/]+\.(css|svg)`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{"/logo.svg", "/static/app.css"})
+}
+
+func TestRegexHandlerSkipsEmptyMatches(t *testing.T) {
+	res, err := crawler.RegexHandler([]byte("baab"), `a*`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, res, []string{"aa"})
+}
+
+func TestRegexProfileValidation(t *testing.T) {
+	endpoint := models.Endpoint{Url: "https://example.com", Profile: "regex"}
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal("pattern is required")
+	}
+
+	endpoint.Options = map[string]string{"pattern": "("}
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal("invalid pattern")
+	}
+
+	endpoint.Options = map[string]string{"pattern": "a+", "flags": "x"}
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal("invalid flag")
+	}
+
+	endpoint.Options = map[string]string{"pattern": "a+", "flags": "im"}
+	if err := crawler.Validate(endpoint); err != nil {
+		t.Fatal(err)
+	}
+}
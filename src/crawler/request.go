@@ -0,0 +1,274 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	database "monitor2/src/db"
+	models "monitor2/src/db/models"
+	"monitor2/src/secrets"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const default_user_agent = "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+// shown instead of secret values, submitting it back keeps the stored value
+const Mask = "********"
+
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// build_request applies the request spec of endpoint: method, headers, body and cookies.
+func build_request(ctx context.Context, endpoint *models.Endpoint) (*http.Request, error) {
+	method := endpoint.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if endpoint.RequestBody != "" {
+		request_body, err := secrets.Expand(endpoint.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(request_body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.Url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", default_user_agent)
+	for name, value := range endpoint.Headers {
+		value, err = secrets.Expand(value)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+
+	for _, name := range sorted_names(endpoint.Cookies) {
+		value, err := secrets.Expand(endpoint.Cookies[name])
+		if err != nil {
+			return nil, err
+		}
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	return req, nil
+}
+
+func validate_request(endpoint models.Endpoint) error {
+	if endpoint.Method != "" && !contains(methods, endpoint.Method) {
+		return fmt.Errorf("Invalid 'method' param, use one of: %s", strings.Join(methods, ", "))
+	}
+	return nil
+}
+
+// ParseHeaders parses one "Name: value" header per line.
+func ParseHeaders(raw string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("Invalid header %q, use 'Name: value'", line)
+		}
+		ret[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return ret, nil
+}
+
+// ParseCookies parses cookies in the Cookie header format, "a=1; b=2".
+func ParseCookies(raw string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, pair := range strings.Split(raw, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, errors.New("Invalid cookies, use 'name=value; name2=value2'")
+		}
+		ret[name] = strings.TrimSpace(value)
+	}
+	return ret, nil
+}
+
+// FormatHeaders is the inverse of ParseHeaders, secret values are masked when mask is set.
+// {{secret:NAME}} references are shown as they are.
+func FormatHeaders(headers map[string]string, mask bool) string {
+	lines := []string{}
+	for _, name := range sorted_names(headers) {
+		value := headers[name]
+		if mask && secrets.SensitiveHeader(name) && !secrets.IsReference(value) {
+			value = Mask
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", name, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatCookies is the inverse of ParseCookies, every value but references is masked when mask is set.
+func FormatCookies(cookies map[string]string, mask bool) string {
+	pairs := []string{}
+	for _, name := range sorted_names(cookies) {
+		value := cookies[name]
+		if mask && !secrets.IsReference(value) {
+			value = Mask
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// FormatBody masks a request body when mask is set, unless it only holds secret references:
+// login, graphql and form bodies often carry credentials.
+func FormatBody(body string, mask bool) string {
+	if !mask {
+		return body
+	}
+
+	rest, _ := secrets.ExpandWith(body, func(name string) (string, error) { return "", nil })
+	if strings.TrimSpace(rest) != "" {
+		return Mask
+	}
+	return body
+}
+
+// KeepMasked replaces values submitted as Mask with the stored ones.
+func KeepMasked(submitted map[string]string, stored map[string]string) {
+	for name, value := range submitted {
+		if value != Mask {
+			continue
+		}
+		if old, ok := stored[name]; ok {
+			submitted[name] = old
+		} else {
+			delete(submitted, name)
+		}
+	}
+}
+
+func sorted_names(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, el := range list {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+// store_secret seals a credential, replaced in tests
+var store_secret = secrets.Store
+
+var invalid_secret_chars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// SealCredentials moves the plain values of sensitive headers and of cookies into secrets
+// called endpoint.<url hash>.header.<name> or .cookie.<name> and references them instead,
+// so Endpoint rows never hold credentials. Returns whether anything was sealed.
+func SealCredentials(endpoint *models.Endpoint) (bool, error) {
+	sum := sha256.Sum256([]byte(endpoint.Url))
+	prefix := "endpoint." + hex.EncodeToString(sum[:6])
+
+	sealed := false
+	for _, name := range sorted_names(endpoint.Headers) {
+		if !secrets.SensitiveHeader(name) {
+			continue
+		}
+
+		value, changed, err := seal(prefix+".header."+secret_suffix(name), "header "+name, endpoint.Headers[name])
+		if err != nil {
+			return false, err
+		}
+		endpoint.Headers[name] = value
+		sealed = sealed || changed
+	}
+
+	for _, name := range sorted_names(endpoint.Cookies) {
+		value, changed, err := seal(prefix+".cookie."+secret_suffix(name), "cookie "+name, endpoint.Cookies[name])
+		if err != nil {
+			return false, err
+		}
+		endpoint.Cookies[name] = value
+		sealed = sealed || changed
+	}
+	return sealed, nil
+}
+
+// seal stores value as the secret called name and returns its reference.
+func seal(name string, label string, value string) (string, bool, error) {
+	if value == "" || secrets.IsReference(value) {
+		return value, false, nil
+	}
+	if secrets.HasReference(value) {
+		return "", false, fmt.Errorf("%s mixes a secret with a plain value, put the whole value in the secret", label)
+	}
+
+	err := store_secret(name, value)
+	if err != nil {
+		return "", false, fmt.Errorf("%s can't be stored as a secret: %w", label, err)
+	}
+	return secrets.Reference(name), true, nil
+}
+
+func secret_suffix(name string) string {
+	return invalid_secret_chars.ReplaceAllString(strings.ToLower(name), "_")
+}
+
+// SealStoredCredentials seals the credentials of endpoints saved before they were sealed on save.
+// It runs on startup, sql migrations can't encrypt.
+func SealStoredCredentials(db *database.Database) error {
+	endpoints, err := db.GetAllEndpoints()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, endpoint := range endpoints {
+		sealed, err := SealCredentials(&endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint.Url, err))
+			continue
+		}
+		if !sealed {
+			continue
+		}
+
+		err = db.UpdateEndpointCredentials(endpoint.Id, endpoint.Headers, endpoint.Cookies)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint.Url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
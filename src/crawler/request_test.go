@@ -0,0 +1,176 @@
+package crawler_test
+
+import (
+	"context"
+	"io"
+	"monitor2/src/crawler"
+	models "monitor2/src/db/models"
+	"strings"
+	"testing"
+)
+
+func TestBuildRequestAppliesSpec(t *testing.T) {
+	endpoint := models.Endpoint{
+		Url:         "https://example.com/graphql",
+		Method:      "POST",
+		Headers:     map[string]string{"Authorization": "Bearer abc", "Content-Type": "application/json"},
+		RequestBody: `{"query":"{ version }"}`,
+		Cookies:     map[string]string{"session": "s1", "theme": "dark"},
+	}
+
+	req, err := crawler.BuildRequest(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Method != "POST" || req.Header.Get("Authorization") != "Bearer abc" {
+		t.Fatalf("%+v", req)
+	}
+	if req.Header.Get("Cookie") != "session=s1; theme=dark" {
+		t.Fatal(req.Header.Get("Cookie"))
+	}
+	if req.Header.Get("User-Agent") == "" {
+		t.Fatal("default user agent missing")
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != endpoint.RequestBody {
+		t.Fatal(string(body), err)
+	}
+}
+
+func TestBuildRequestDefaultsToGet(t *testing.T) {
+	endpoint := models.Endpoint{Url: "https://example.com", Headers: map[string]string{"User-Agent": "monitor2"}}
+	req, err := crawler.BuildRequest(context.Background(), &endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.Body != nil || req.Header.Get("User-Agent") != "monitor2" {
+		t.Fatalf("%+v", req)
+	}
+}
+
+func TestParseAndFormatHeaders(t *testing.T) {
+	headers, err := crawler.ParseHeaders("x-api-key: k1\n\naccept: text/html\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers["X-Api-Key"] != "k1" || headers["Accept"] != "text/html" {
+		t.Fatalf("%+v", headers)
+	}
+
+	if got := crawler.FormatHeaders(headers, true); got != "Accept: text/html\nX-Api-Key: "+crawler.Mask {
+		t.Fatal(got)
+	}
+
+	if _, err := crawler.ParseHeaders("no colon"); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestParseAndFormatCookies(t *testing.T) {
+	cookies, err := crawler.ParseCookies("b=2; a=1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := crawler.FormatCookies(cookies, false); got != "a=1; b=2" {
+		t.Fatal(got)
+	}
+	if got := crawler.FormatCookies(cookies, true); got != "a="+crawler.Mask+"; b="+crawler.Mask {
+		t.Fatal(got)
+	}
+
+	if _, err := crawler.ParseCookies("novalue"); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestKeepMasked(t *testing.T) {
+	submitted := map[string]string{"Authorization": crawler.Mask, "Accept": "*/*", "X-New": crawler.Mask}
+	crawler.KeepMasked(submitted, map[string]string{"Authorization": "Bearer abc"})
+
+	if submitted["Authorization"] != "Bearer abc" || submitted["Accept"] != "*/*" {
+		t.Fatalf("%+v", submitted)
+	}
+	if _, ok := submitted["X-New"]; ok {
+		t.Fatal("masked value without a stored one should be dropped")
+	}
+}
+
+func TestValidateMethod(t *testing.T) {
+	endpoint := models.Endpoint{Url: "https://example.com", Profile: "js", Method: "FETCH"}
+	if err := crawler.Validate(endpoint); err == nil {
+		t.Fatal()
+	}
+	endpoint.Method = "POST"
+	if err := crawler.Validate(endpoint); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatShowsSecretReferences(t *testing.T) {
+	headers := map[string]string{"Authorization": "{{secret:api_token}}"}
+	if got := crawler.FormatHeaders(headers, true); got != "Authorization: {{secret:api_token}}" {
+		t.Fatal(got)
+	}
+
+	cookies := map[string]string{"session": "{{secret:session}}"}
+	if got := crawler.FormatCookies(cookies, true); got != "session={{secret:session}}" {
+		t.Fatal(got)
+	}
+}
+
+func TestFormatBodyMasksPlainValues(t *testing.T) {
+	if got := crawler.FormatBody("user=me&password=hunter2", true); got != crawler.Mask {
+		t.Fatal(got)
+	}
+	if got := crawler.FormatBody(" {{secret:login_body}}\n", true); got != " {{secret:login_body}}\n" {
+		t.Fatal(got)
+	}
+	if got := crawler.FormatBody("", true); got != "" {
+		t.Fatal(got)
+	}
+}
+
+func TestSealCredentials(t *testing.T) {
+	stored := map[string]string{}
+	defer crawler.SetStoreSecret(func(name string, value string) error {
+		stored[name] = value
+		return nil
+	})()
+
+	endpoint := models.Endpoint{
+		Url:     "https://example.com/api",
+		Headers: map[string]string{"Authorization": "Bearer abc", "Accept": "application/json", "X-Api-Key": "{{secret:api_key}}"},
+		Cookies: map[string]string{"sid": "s1"},
+	}
+
+	sealed, err := crawler.SealCredentials(&endpoint)
+	if err != nil || !sealed {
+		t.Fatal(sealed, err)
+	}
+
+	if endpoint.Headers["Accept"] != "application/json" || endpoint.Headers["X-Api-Key"] != "{{secret:api_key}}" {
+		t.Fatal(endpoint.Headers)
+	}
+	if len(stored) != 2 {
+		t.Fatal(stored)
+	}
+	value := func(reference string) string {
+		return stored[strings.TrimSuffix(strings.TrimPrefix(reference, "{{secret:"), "}}")]
+	}
+	if value(endpoint.Headers["Authorization"]) != "Bearer abc" || value(endpoint.Cookies["sid"]) != "s1" {
+		t.Fatal(endpoint.Headers, endpoint.Cookies, stored)
+	}
+
+	// already sealed
+	sealed, err = crawler.SealCredentials(&endpoint)
+	if err != nil || sealed {
+		t.Fatal(sealed, err)
+	}
+
+	endpoint.Headers["Authorization"] = "Bearer {{secret:token}} extra"
+	if _, err := crawler.SealCredentials(&endpoint); err == nil {
+		t.Fatal("mixed value sealed")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"monitor2/src/db/models"
 	"os"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -49,8 +50,39 @@ func Init() error {
 	return nil
 }
 
-func (db Database) GetManyEndpointsBySchedule(schedule int) ([]models.Endpoint, error) {
-	rows, err := db.Pool.Query(context.Background(), "SELECT * FROM Endpoint WHERE schedule_hours = $1", schedule)
+// MarkEndpointsDue makes every endpoint running every schedule hours due at now,
+// the scheduler claims them like any other due endpoint.
+func (db Database) MarkEndpointsDue(schedule int, now time.Time) (int, error) {
+	tag, err := db.Pool.Exec(context.Background(),
+		`UPDATE Endpoint SET next_run_at = $2
+    WHERE deleted = false AND schedule_hours = $1 AND next_run_at > $2`,
+		schedule,
+		now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimDueEndpoints returns at most limit endpoints that have to run at now, the most overdue first,
+// and pushes their next run to lease, so other replicas skip them. The job sets the real next run.
+// SKIP LOCKED makes concurrent claims return disjoint rows.
+func (db Database) ClaimDueEndpoints(now time.Time, lease time.Time, limit int) ([]models.Endpoint, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`UPDATE Endpoint SET next_run_at = $2
+    WHERE id IN (
+      SELECT id FROM Endpoint
+      WHERE deleted = false AND next_run_at <= $1
+      ORDER BY next_run_at
+      LIMIT $3
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *`,
+		now,
+		lease,
+		limit,
+	)
 	if err != nil {
 		return []models.Endpoint{}, err
 	}
@@ -61,6 +93,34 @@ func (db Database) GetManyEndpointsBySchedule(schedule int) ([]models.Endpoint,
 	return r, nil
 }
 
+// ReleaseEndpoint makes a claimed endpoint due again at now, for jobs that never started.
+// Rows whose lease was already replaced are left alone.
+func (db Database) ReleaseEndpoint(id int, lease time.Time, now time.Time) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Endpoint SET next_run_at = $3 WHERE id = $1 AND next_run_at = $2`,
+		id,
+		lease,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) SetEndpointRun(id int, last_run_at time.Time, next_run_at time.Time) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Endpoint SET last_run_at = $2, next_run_at = $3 WHERE id = $1`,
+		id,
+		last_run_at,
+		next_run_at,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (db Database) GetEndpointByUrl(url string) (models.Endpoint, error) {
 	rows, err := db.Pool.Query(context.Background(), "SELECT * FROM Endpoint WHERE url = $1", url)
 	if err != nil {
@@ -73,40 +133,65 @@ func (db Database) GetEndpointByUrl(url string) (models.Endpoint, error) {
 	return r, nil
 }
 
-func (db Database) CreateEndpoint(endpoint models.Endpoint) error {
-	_, err := db.Pool.Exec(context.Background(),
-		`INSERT INTO Endpoint ( url, status_code, response_body, previous_response_body, selector, profile )
-    VALUES ( $1, $2, $3, $4, $5, $6 )`,
+func (db Database) CreateEndpoint(endpoint models.Endpoint) (int, error) {
+	var id int
+	err := db.Pool.QueryRow(context.Background(),
+		`INSERT INTO Endpoint ( url, status_code, response_body, previous_response_body, selector, profile, tags, schedule_hours, next_run_at, schedule_cron, timezone, options, method, headers, request_body, cookies, session, timeout_seconds )
+    VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18 )
+    RETURNING id`,
 		endpoint.Url,
 		endpoint.StatusCode,
 		endpoint.ResponseBody,
 		endpoint.PreviousResponseBody,
 		endpoint.Selector,
 		endpoint.Profile,
-	)
+		endpoint.Tags,
+		endpoint.ScheduleHours,
+		endpoint.NextRunAt,
+		endpoint.ScheduleCron,
+		endpoint.Timezone,
+		json_map(endpoint.Options),
+		endpoint_method(endpoint),
+		json_map(endpoint.Headers),
+		endpoint.RequestBody,
+		json_map(endpoint.Cookies),
+		endpoint.Session,
+		endpoint.TimeoutSeconds,
+	).Scan(&id)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
+// UpdateEndpointByUrl stores the settings of endpoint, or with from_crawler the results of a crawl.
+// A crawl doesn't touch the settings and only stores validators and content hash
+// when the endpoint wasn't edited since it was loaded, they belong to the old settings.
 func (db Database) UpdateEndpointByUrl(endpoint models.Endpoint, from_crawler bool) error {
 	if from_crawler {
 		_, err := db.Pool.Exec(context.Background(),
 			`UPDATE Endpoint
-      SET url = $1,
-      status_code = $2,
+      SET status_code = $2,
       response_body = $3,
       previous_response_body = $4,
-      selector = $5,
-      profile = $6
+      consecutive_failures = $5,
+      final_url = $6,
+      redirects = $7,
+      etag = CASE WHEN revision = $11 THEN $8 ELSE etag END,
+      last_modified = CASE WHEN revision = $11 THEN $9 ELSE last_modified END,
+      content_hash = CASE WHEN revision = $11 THEN $10 ELSE content_hash END
       WHERE url = $1`,
 			endpoint.Url,
 			endpoint.StatusCode,
 			endpoint.ResponseBody,
 			endpoint.PreviousResponseBody,
-			endpoint.Selector,
-			endpoint.Profile,
+			endpoint.ConsecutiveFailures,
+			endpoint.FinalUrl,
+			text_array(endpoint.Redirects),
+			endpoint.ETag,
+			endpoint.LastModified,
+			endpoint.ContentHash,
+			endpoint.Revision,
 		)
 		if err != nil {
 			return err
@@ -119,12 +204,40 @@ func (db Database) UpdateEndpointByUrl(endpoint models.Endpoint, from_crawler bo
       SET url = $1,
       selector = $2,
       profile = $3,
-      deleted = $4
+      deleted = $4,
+      tags = $5,
+      schedule_hours = $6,
+      next_run_at = $7,
+      schedule_cron = $8,
+      timezone = $9,
+      options = $10,
+      method = $11,
+      headers = $12,
+      request_body = $13,
+      cookies = $14,
+      session = $15,
+      timeout_seconds = $16,
+      etag = '',
+      last_modified = '',
+      content_hash = '',
+      revision = revision + 1
       WHERE url = $1`,
 		endpoint.Url,
 		endpoint.Selector,
 		endpoint.Profile,
     endpoint.Deleted,
+		endpoint.Tags,
+		endpoint.ScheduleHours,
+		endpoint.NextRunAt,
+		endpoint.ScheduleCron,
+		endpoint.Timezone,
+		json_map(endpoint.Options),
+		endpoint_method(endpoint),
+		json_map(endpoint.Headers),
+		endpoint.RequestBody,
+		json_map(endpoint.Cookies),
+		endpoint.Session,
+		endpoint.TimeoutSeconds,
 	)
 	if err != nil {
 		return err
@@ -132,6 +245,43 @@ func (db Database) UpdateEndpointByUrl(endpoint models.Endpoint, from_crawler bo
 	return nil
 }
 
+// UpdateEndpointCredentials replaces the headers and cookies of an endpoint, once they are sealed.
+func (db Database) UpdateEndpointCredentials(id int, headers map[string]string, cookies map[string]string) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Endpoint SET headers = $2, cookies = $3 WHERE id = $1`,
+		id,
+		json_map(headers),
+		json_map(cookies),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// json columns are NOT NULL, a nil map would be stored as null
+func json_map(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// text[] columns are NOT NULL too
+func text_array(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func endpoint_method(endpoint models.Endpoint) string {
+	if endpoint.Method == "" {
+		return "GET"
+	}
+	return endpoint.Method
+}
+
 func (db Database) DeleteEndpoint(endpoint models.Endpoint) (int, error) {
 	t, err := db.Pool.Exec(context.Background(),
 		"DELETE FROM Endpoint WHERE url = $1",
@@ -186,22 +336,69 @@ func (db Database) GetAllRepos() ([]models.Repository, error) {
 	return diff, nil
 }
 
-func (db Database) GetManyRepositoriesBySchedule(schedule int) ([]models.Repository, error) {
-	rows, err := db.Pool.Query(
-		context.Background(),
-		"SELECT * FROM Repository WHERE schedule_hours = $1",
-		schedule,
+// ClaimDueRepositories works like ClaimDueEndpoints.
+func (db Database) ClaimDueRepositories(now time.Time, lease time.Time, limit int) ([]models.Repository, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`UPDATE Repository SET next_run_at = $2
+    WHERE id IN (
+      SELECT id FROM Repository
+      WHERE deleted = false AND next_run_at <= $1
+      ORDER BY next_run_at
+      LIMIT $3
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *`,
+		now,
+		lease,
+		limit,
 	)
-
 	if err != nil {
 		return []models.Repository{}, err
 	}
-
 	r, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Repository])
 	if err != nil {
 		return []models.Repository{}, err
 	}
+	return r, nil
+}
+
+// ReleaseRepository makes a claimed repository due again at now, for jobs that never started.
+// Rows whose lease was already replaced are left alone.
+func (db Database) ReleaseRepository(id int, lease time.Time, now time.Time) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Repository SET next_run_at = $3 WHERE id = $1 AND next_run_at = $2`,
+		id,
+		lease,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) SetRepositoryRun(id int, last_run_at time.Time, next_run_at time.Time) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Repository SET last_run_at = $2, next_run_at = $3 WHERE id = $1`,
+		id,
+		last_run_at,
+		next_run_at,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
+func (db Database) GetRepositoryById(id int) (models.Repository, error) {
+	rows, err := db.Pool.Query(context.Background(), "SELECT * FROM Repository WHERE id = $1", id)
+	if err != nil {
+		return models.Repository{}, err
+	}
+	r, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Repository])
+	if err != nil {
+		return models.Repository{}, err
+	}
 	return r, nil
 }
 
@@ -213,7 +410,13 @@ func (db Database) UpdateRepository(id int, repository models.Repository) error
     watched_files = $4,
     remote = $5,
     schedule_hours = $6,
-    deleted = $7
+    deleted = $7,
+    tags = $8,
+    next_run_at = $9,
+    schedule_cron = $10,
+    timezone = $11,
+    auth_username = $12,
+    auth_secret = $13
     WHERE id = $1`,
 		id,
 		repository.Url,
@@ -222,6 +425,24 @@ func (db Database) UpdateRepository(id int, repository models.Repository) error
 		repository.Remote,
 		repository.ScheduleHours,
 		repository.Deleted,
+		repository.Tags,
+		repository.NextRunAt,
+		repository.ScheduleCron,
+		repository.Timezone,
+		repository.AuthUsername,
+		repository.AuthSecret,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) UpdateRepositoryFailures(id int, failures int) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Repository SET consecutive_failures = $2 WHERE id = $1`,
+		id,
+		failures,
 	)
 	if err != nil {
 		return err
@@ -231,12 +452,19 @@ func (db Database) UpdateRepository(id int, repository models.Repository) error
 
 func (db Database) CreateRepository(repository models.Repository) error {
 	_, err := db.Pool.Exec(context.Background(),
-		`INSERT INTO Repository ( url, directory, watched_files, remote )
-    VALUES ( $1, $2, $3, $4 )`,
+		`INSERT INTO Repository ( url, directory, watched_files, remote, tags, schedule_hours, next_run_at, schedule_cron, timezone, auth_username, auth_secret )
+    VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11 )`,
 		repository.Url,
 		repository.Directory,
 		repository.WatchedFiles,
 		repository.Remote,
+		repository.Tags,
+		repository.ScheduleHours,
+		repository.NextRunAt,
+		repository.ScheduleCron,
+		repository.Timezone,
+		repository.AuthUsername,
+		repository.AuthSecret,
 	)
 	if err != nil {
 		return err
@@ -289,3 +517,479 @@ func (db Database) CreateDiff(diff models.Diff) error {
 	}
 	return nil
 }
+
+func (db Database) CreateWebhookDelivery(delivery models.WebhookDelivery) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO WebhookDelivery ( url, payload, attempts, status_code, error )
+    VALUES ( $1, $2, $3, $4, $5 )`,
+		delivery.Url,
+		delivery.Payload,
+		delivery.Attempts,
+		delivery.StatusCode,
+		delivery.Error,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) CreateAlertLog(alert models.AlertLog) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO AlertLog ( source, kind, url, body, link, suppressed, reason )
+    VALUES ( $1, $2, $3, $4, $5, $6, $7 )`,
+		alert.Source,
+		alert.Kind,
+		alert.Url,
+		alert.Body,
+		alert.Link,
+		alert.Suppressed,
+		alert.Reason,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) GetAlertLogs(suppressed_only bool, limit int) ([]models.AlertLog, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM AlertLog
+    WHERE suppressed OR NOT $1
+    ORDER BY created_at DESC
+    LIMIT $2`,
+		suppressed_only,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.AlertLog])
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (db Database) GetRecentFingerprints(target string, n int) ([]string, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT fingerprint FROM AlertFingerprint
+    WHERE target = $1
+    ORDER BY id DESC
+    LIMIT $2`,
+		target,
+		n,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateFingerprint stores fingerprint and only keeps the last `keep` ones for target.
+func (db Database) CreateFingerprint(target string, fingerprint string, keep int) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO AlertFingerprint ( target, fingerprint ) VALUES ( $1, $2 )`,
+		target,
+		fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Pool.Exec(context.Background(),
+		`DELETE FROM AlertFingerprint
+    WHERE target = $1
+    AND id NOT IN (SELECT id FROM AlertFingerprint WHERE target = $1 ORDER BY id DESC LIMIT $2)`,
+		target,
+		keep,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CountPendingChange counts the consecutive runs fingerprint was seen for target,
+// a different fingerprint starts counting again at 1.
+func (db Database) CountPendingChange(target string, fingerprint string) (int, error) {
+	var runs int
+	err := db.Pool.QueryRow(context.Background(),
+		`INSERT INTO PendingChange ( target, fingerprint, runs ) VALUES ( $1, $2, 1 )
+    ON CONFLICT (target) DO UPDATE SET
+    runs = CASE WHEN PendingChange.fingerprint = $2 THEN PendingChange.runs + 1 ELSE 1 END,
+    fingerprint = $2,
+    updated_at = CURRENT_TIMESTAMP
+    RETURNING runs`,
+		target,
+		fingerprint,
+	).Scan(&runs)
+	if err != nil {
+		return 0, err
+	}
+	return runs, nil
+}
+
+func (db Database) DeletePendingChange(target string) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`DELETE FROM PendingChange WHERE target = $1`,
+		target,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) GetAllRoutes() ([]models.Route, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Route ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Route])
+	if err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (db Database) CreateRoute(route models.Route) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO Route ( target_type, target_id, url_pattern, tag, destinations, severity )
+    VALUES ( $1, $2, $3, $4, $5, $6 )`,
+		route.TargetType,
+		route.TargetId,
+		route.UrlPattern,
+		route.Tag,
+		route.Destinations,
+		route.Severity,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) UpdateRoute(route models.Route) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`UPDATE Route
+    SET target_type = $2,
+    target_id = $3,
+    url_pattern = $4,
+    tag = $5,
+    destinations = $6,
+    severity = $7
+    WHERE id = $1`,
+		route.Id,
+		route.TargetType,
+		route.TargetId,
+		route.UrlPattern,
+		route.Tag,
+		route.Destinations,
+		route.Severity,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) DeleteRoute(id int) (int, error) {
+	t, err := db.Pool.Exec(context.Background(),
+		"DELETE FROM Route WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.RowsAffected()), nil
+}
+
+func (db Database) CreateSnapshot(snapshot models.Snapshot) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO Snapshot ( endpoint_id, body, status_code, diff_id )
+    VALUES ( $1, $2, $3, $4 )`,
+		snapshot.EndpointId,
+		snapshot.Body,
+		snapshot.StatusCode,
+		snapshot.DiffId,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetLatestSnapshot returns pgx.ErrNoRows when the endpoint has no snapshots yet.
+func (db Database) GetLatestSnapshot(endpoint_id int) (models.Snapshot, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Snapshot WHERE endpoint_id = $1 ORDER BY id DESC LIMIT 1`,
+		endpoint_id,
+	)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	snapshot, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Snapshot])
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (db Database) GetSnapshot(id int) (models.Snapshot, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Snapshot WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	snapshot, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Snapshot])
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (db Database) GetSnapshots(endpoint_id int) ([]models.Snapshot, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT id, endpoint_id, '' as body, status_code, diff_id, created_at
+    FROM Snapshot WHERE endpoint_id = $1 ORDER BY id DESC`,
+		endpoint_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Snapshot])
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (db Database) GetEndpointById(id int) (models.Endpoint, error) {
+	rows, err := db.Pool.Query(context.Background(), "SELECT * FROM Endpoint WHERE id = $1", id)
+	if err != nil {
+		return models.Endpoint{}, err
+	}
+	r, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Endpoint])
+	if err != nil {
+		return models.Endpoint{}, err
+	}
+	return r, nil
+}
+
+func (db Database) CreateRun(run models.Run) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO Run ( target_type, target_id, url, started_at, finished_at, duration_ms, status_code, commit_range, bytes, lines, diff, alerted, stage, error )
+    VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 )`,
+		run.TargetType,
+		run.TargetId,
+		run.Url,
+		run.StartedAt,
+		run.FinishedAt,
+		run.DurationMs,
+		run.StatusCode,
+		run.CommitRange,
+		run.Bytes,
+		run.Lines,
+		run.Diff,
+		run.Alerted,
+		run.Stage,
+		run.Error,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RunFilter narrows GetRuns, empty/zero fields match everything.
+type RunFilter struct {
+	TargetType string
+	TargetId   int
+	Url        string
+	FailedOnly bool
+	DiffOnly   bool
+	Since      time.Time
+	Limit      int
+}
+
+func (db Database) GetRuns(filter RunFilter) ([]models.Run, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Run
+    WHERE ($1 = '' OR target_type = $1)
+    AND ($2 = 0 OR target_id = $2)
+    AND strpos(url, $3) > 0
+    AND (error <> '' OR NOT $4)
+    AND (diff OR NOT $5)
+    AND started_at >= $6
+    ORDER BY started_at DESC
+    LIMIT $7`,
+		filter.TargetType,
+		filter.TargetId,
+		filter.Url,
+		filter.FailedOnly,
+		filter.DiffOnly,
+		filter.Since,
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Run])
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// CreateSecret stores value, it is already encrypted.
+func (db Database) CreateSecret(name string, value []byte) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO Secret ( name, value ) VALUES ( $1, $2 )`,
+		name,
+		value,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RotateSecret replaces the encrypted value of the secret called name.
+func (db Database) RotateSecret(name string, value []byte) (int, error) {
+	t, err := db.Pool.Exec(context.Background(),
+		`UPDATE Secret SET value = $2, rotated_at = CURRENT_TIMESTAMP WHERE name = $1`,
+		name,
+		value,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.RowsAffected()), nil
+}
+
+func (db Database) GetSecret(name string) (models.Secret, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Secret WHERE name = $1`,
+		name,
+	)
+	if err != nil {
+		return models.Secret{}, err
+	}
+
+	secret, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Secret])
+	if err != nil {
+		return models.Secret{}, err
+	}
+	return secret, nil
+}
+
+// GetAllSecrets leaves out the values.
+func (db Database) GetAllSecrets() ([]models.Secret, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT id, name, ''::bytea AS value, created_at, rotated_at FROM Secret ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Secret])
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (db Database) DeleteSecret(name string) (int, error) {
+	t, err := db.Pool.Exec(context.Background(),
+		"DELETE FROM Secret WHERE name = $1",
+		name,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.RowsAffected()), nil
+}
+
+func (db Database) GetAllSessions() ([]models.Session, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Session ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Session])
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (db Database) GetSession(name string) (models.Session, error) {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT * FROM Session WHERE name = $1`,
+		name,
+	)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	session, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Session])
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+func (db Database) CreateSession(session models.Session) error {
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO Session ( name, steps, logged_out_pattern ) VALUES ( $1, $2, $3 )`,
+		session.Name,
+		session.Steps,
+		session.LoggedOutPattern,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db Database) UpdateSession(session models.Session) (int, error) {
+	t, err := db.Pool.Exec(context.Background(),
+		`UPDATE Session SET steps = $2, logged_out_pattern = $3 WHERE name = $1`,
+		session.Name,
+		session.Steps,
+		session.LoggedOutPattern,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.RowsAffected()), nil
+}
+
+func (db Database) DeleteSession(name string) (int, error) {
+	t, err := db.Pool.Exec(context.Background(),
+		"DELETE FROM Session WHERE name = $1",
+		name,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.RowsAffected()), nil
+}
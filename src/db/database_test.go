@@ -5,6 +5,7 @@ import (
 	"log"
 	database "monitor2/src/db"
 	"monitor2/src/db/models"
+	"slices"
 	"time"
 
 	"testing"
@@ -203,3 +204,223 @@ func TestCreatesAndGetsDiff(t *testing.T) {
 
   clean_db()
 }
+
+func TestSnapshots(t *testing.T) {
+  start_test_db()
+
+	id, err := DB.CreateEndpoint(models.Endpoint{
+		Url:     "https://example.com/snapshots",
+		Profile: "js",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"a", "b"} {
+		err = DB.CreateSnapshot(models.Snapshot{EndpointId: id, Body: body, StatusCode: 200})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := DB.GetLatestSnapshot(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Body != "b" {
+		t.Fatal(latest)
+	}
+
+	snapshots, err := DB.GetSnapshots(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Id != latest.Id {
+		t.Fatal(snapshots)
+	}
+
+  clean_db()
+}
+
+func TestClaimDueEndpoints(t *testing.T) {
+  start_test_db()
+
+	now := time.Now()
+	_, err := DB.CreateEndpoint(models.Endpoint{
+		Url:           "https://example.com/due",
+		Profile:       "js",
+		ScheduleHours: 12,
+		NextRunAt:     now.Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DB.CreateEndpoint(models.Endpoint{
+		Url:           "https://example.com/later",
+		Profile:       "js",
+		ScheduleHours: 12,
+		NextRunAt:     now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lease := now.Add(time.Hour)
+	due_urls := func() []string {
+		due, err := DB.ClaimDueEndpoints(now, lease, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		urls := []string{}
+		for _, endpoint := range due {
+			urls = append(urls, endpoint.Url)
+		}
+		return urls
+	}
+
+	urls := due_urls()
+	if !slices.Contains(urls, "https://example.com/due") || slices.Contains(urls, "https://example.com/later") {
+		t.Fatal(urls)
+	}
+
+	// another replica doesn't get it while the lease holds
+	if slices.Contains(due_urls(), "https://example.com/due") {
+		t.Fatal("endpoint claimed twice")
+	}
+
+	endpoint, err := DB.GetEndpointByUrl("https://example.com/due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !endpoint.NextRunAt.Equal(lease.Truncate(time.Microsecond)) {
+		t.Fatal(endpoint.NextRunAt)
+	}
+
+	// a job that never started gives its claim back
+	err = DB.ReleaseEndpoint(endpoint.Id, lease, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(due_urls(), "https://example.com/due") {
+		t.Fatal("released endpoint not due")
+	}
+
+	// limit caps the claim
+	due, err := DB.ClaimDueEndpoints(now.Add(2*time.Hour), lease.Add(2*time.Hour), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatal(due)
+	}
+
+  clean_db()
+}
+
+func TestCrawlerUpdateKeepsEdits(t *testing.T) {
+  start_test_db()
+
+	_, err := DB.CreateEndpoint(models.Endpoint{Url: "https://example.com/edited", Profile: "html", Selector: "h1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// loaded by a crawl, then edited while it runs
+	crawled, err := DB.GetEndpointByUrl("https://example.com/edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := crawled
+	edited.Selector = "h2"
+	err = DB.UpdateEndpointByUrl(edited, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawled.StatusCode = 200
+	crawled.ETag = `"v1"`
+	crawled.ContentHash = "abc"
+	err = DB.UpdateEndpointByUrl(crawled, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint, err := DB.GetEndpointByUrl("https://example.com/edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.Selector != "h2" || endpoint.StatusCode != 200 || endpoint.ETag != "" || endpoint.ContentHash != "" {
+		t.Fatalf("%+v", endpoint)
+	}
+
+  clean_db()
+}
+
+func TestPendingChanges(t *testing.T) {
+  start_test_db()
+
+	for i, fingerprint := range []string{"A", "A", "B"} {
+		runs, err := DB.CountPendingChange("e", fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []int{1, 2, 1}[i]; runs != want {
+			t.Fatalf("run %d: got %d, want %d", i, runs, want)
+		}
+	}
+
+	err := DB.DeletePendingChange("e")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := DB.CountPendingChange("e", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Fatalf("got %d after delete", runs)
+	}
+
+  clean_db()
+}
+
+func TestMarkEndpointsDue(t *testing.T) {
+  start_test_db()
+
+	now := time.Now()
+	for _, endpoint := range []models.Endpoint{
+		{Url: "https://example.com/daily", Profile: "js", ScheduleHours: 24, NextRunAt: now.Add(time.Hour)},
+		{Url: "https://example.com/hourly", Profile: "js", ScheduleHours: 1, NextRunAt: now.Add(time.Hour)},
+	} {
+		_, err := DB.CreateEndpoint(endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := DB.MarkEndpointsDue(24, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatal(n)
+	}
+
+	due, err := DB.ClaimDueEndpoints(now, now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{}
+	for _, endpoint := range due {
+		urls = append(urls, endpoint.Url)
+	}
+	if !slices.Contains(urls, "https://example.com/daily") || slices.Contains(urls, "https://example.com/hourly") {
+		t.Fatal(urls)
+	}
+
+  clean_db()
+}
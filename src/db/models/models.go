@@ -13,17 +13,53 @@ type Endpoint struct {
 	Profile              string
 	Deleted              bool
 	UpdatedAt            time.Time
+	ConsecutiveFailures  int
+	Tags                 string
+	LastRunAt            *time.Time
+	NextRunAt            time.Time
+	ScheduleCron         string
+	Timezone             string
+	// extractor params other than selector
+	Options              map[string]string
+	// request spec, GET without extra headers by default
+	Method               string
+	Headers              map[string]string
+	RequestBody          string
+	Cookies              map[string]string
+	// name of the login Session used to crawl it, if any
+	Session              string
+	// FETCH_TIMEOUT_SECONDS when 0
+	TimeoutSeconds       int
+	// where the last crawl ended up after Redirects
+	FinalUrl             string
+	Redirects            []string
+	// validators and sha256 of the raw body behind ResponseBody,
+	// empty until a crawl stores them and whenever the endpoint is edited
+	ETag                 string
+	LastModified         string
+	ContentHash          string
+	// bumped on every edit, crawls of an older revision don't store validators
+	Revision             int
 }
 
 type Repository struct {
-	Id            int
-	Url           string
-	Directory     string
-	WatchedFiles  []byte
-	Remote        string
-	ScheduleHours int
-	Deleted       bool
-	UpdatedAt     time.Time
+	Id                  int
+	Url                 string
+	Directory           string
+	WatchedFiles        []byte
+	Remote              string
+	ScheduleHours       int
+	Deleted             bool
+	UpdatedAt           time.Time
+	ConsecutiveFailures int
+	Tags                string
+	LastRunAt           *time.Time
+	NextRunAt           time.Time
+	ScheduleCron        string
+	Timezone            string
+	// git credentials, the password/token or ssh key is the secret called AuthSecret
+	AuthUsername        string
+	AuthSecret          string
 }
 
 type Diff struct {
@@ -33,3 +69,90 @@ type Diff struct {
   Commit    string
 	CreatedAt time.Time
 }
+
+type WebhookDelivery struct {
+	Id         int
+	Url        string
+	Payload    string
+	Attempts   int
+	StatusCode int
+	Error      string
+	CreatedAt  time.Time
+}
+
+type AlertLog struct {
+	Id         int
+	Source     string
+	Kind       string
+	Url        string
+	Body       string
+	Link       string
+	Suppressed bool
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// Route sends the alerts of matching targets to Destinations.
+// Empty/zero fields match everything.
+type Route struct {
+	Id           int
+	TargetType   string
+	TargetId     int
+	UrlPattern   string
+	Tag          string
+	Destinations string
+	Severity     string
+	CreatedAt    time.Time
+}
+
+// Snapshot is a distinct extracted result of an endpoint,
+// DiffId points to the diff with the previous snapshot.
+type Snapshot struct {
+	Id         int
+	EndpointId int
+	Body       string
+	StatusCode int
+	DiffId     string
+	CreatedAt  time.Time
+}
+
+// Run is a single crawl of an endpoint or pull of a repository.
+// CommitRange is "<old>..<new>" for repositories, Stage and Error are set when it failed.
+type Run struct {
+	Id          int
+	TargetType  string
+	TargetId    int
+	Url         string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	DurationMs  int
+	StatusCode  int
+	CommitRange string
+	Bytes       int
+	Lines       int
+	Diff        bool
+	Alerted     bool
+	Stage       string
+	Error       string
+}
+
+// Secret holds a credential encrypted with the master key,
+// request specs and repositories reference it by Name.
+type Secret struct {
+	Id        int
+	Name      string
+	Value     []byte
+	CreatedAt time.Time
+	RotatedAt *time.Time
+}
+
+// Session is a login recipe, Steps is a json array of requests whose cookies
+// are kept for the endpoints using it. LoggedOutPattern matches the path of the url
+// the monitored page redirects to once the session expired.
+type Session struct {
+	Id               int
+	Name             string
+	Steps            []byte
+	LoggedOutPattern string
+	CreatedAt        time.Time
+}
@@ -46,7 +46,11 @@ func Diff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	github_url := fmt.Sprintf("%s/commit/%s", diff.Url, diff.Commit)
+	// crawler diffs have no commit
+	github_url := ""
+	if diff.Commit != "" {
+		github_url = fmt.Sprintf("%s/commit/%s", diff.Url, diff.Commit)
+	}
 	err = template.ExecuteTemplate(w, "diff.html", map[string]string{"body": diff.Body, "github_url": github_url})
 	if err != nil {
 		fmt.Fprint(w, err)
@@ -1,5 +1,21 @@
 package repositories
 
-var GitPullAndDiff = gitPullAndDiff
-var GitClone = gitClone
+import (
+	"context"
+	"monitor2/src/db/models"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func GitPullAndDiff(repository models.Repository, pull_opts git.PullOptions) (string, string, error) {
+	diff, _, commit, err := gitPullAndDiff(context.Background(), repository, pull_opts)
+	return diff, commit, err
+}
+
+func GitClone(url string, dir string) (*git.Repository, error) {
+	return gitClone(context.Background(), url, dir, nil)
+}
+
 var ParseDiff = parse_diff 
+
+var RepoDirectory = repo_directory
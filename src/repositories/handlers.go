@@ -2,30 +2,56 @@ package repositories
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"monitor2/src/alerts"
 	database "monitor2/src/db"
 	"monitor2/src/db/models"
+	"monitor2/src/schedule"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
+type repository_view struct {
+	models.Repository
+	Routes []models.Route
+	// next run in the timezone of the repository
+	NextRun string
+}
+
 func Repos(w http.ResponseWriter, r *http.Request) {
-	repos, err := database.DB.GetAllRepos()
+	repositories, err := database.DB.GetAllRepos()
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
 	}
 
+	routes, err := database.DB.GetAllRoutes()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	views := []repository_view{}
+	for _, repository := range repositories {
+		views = append(views, repository_view{
+			Repository: repository,
+			Routes:     alerts.RoutesFor(routes, alert_target(repository)),
+			NextRun:    schedule.Format(repository.NextRunAt, repository.Timezone),
+		})
+	}
+
 	template, err := template.ParseFiles("static/templates/repos.html")
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
 	}
 
-	err = template.ExecuteTemplate(w, "repos.html", repos)
+	err = template.ExecuteTemplate(w, "repos.html", views)
 	if err != nil {
 		fmt.Fprint(w, err)
 		return
@@ -33,53 +59,96 @@ func Repos(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateRepo(w http.ResponseWriter, r *http.Request) {
+	repo := models.Repository{
+		Url:          r.PostFormValue("url"),
+		WatchedFiles: []byte(r.PostFormValue("files")),
+		Remote:       r.PostFormValue("remote"),
+		Tags:         r.PostFormValue("tags"),
+		ScheduleCron: r.PostFormValue("schedule_cron"),
+		Timezone:     r.PostFormValue("timezone"),
+		AuthUsername: r.PostFormValue("auth_username"),
+		AuthSecret:   r.PostFormValue("auth_secret"),
+	}
+
+	if r.PostFormValue("schedule_hours") != "" {
+		hours, err := strconv.Atoi(r.PostFormValue("schedule_hours"))
+		if err != nil {
+			fmt.Fprint(w, "Invalid schedule_hours value")
+			return
+		}
+		repo.ScheduleHours = hours
+	}
+
+	err := Create(repo)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Repo created")
+}
+
+// Create stores a new repository and clones it in the background.
+// WatchedFiles is a json array of the watched files.
+func Create(repo models.Repository) error {
 	repos_path := os.Getenv("REPOS_PATH")
+	url := repo.Url
+	files := string(repo.WatchedFiles)
 
-	url := r.PostFormValue("url")
 	if len(url) == 0 {
-		fmt.Fprint(w, "url can't be empty.")
-    return
+		return errors.New("url can't be empty.")
 	}
 
-	if strings.Contains("..", url) {
-		fmt.Fprint(w, "No path traversal pls")
-    return
+	if strings.Contains(url, "..") {
+		return errors.New("No path traversal pls")
 	}
 
-	files := r.PostFormValue("files")
   if len(files) == 0 || files == "[]" {
-		fmt.Fprint(w, "files can't be empty.")
-		return
+		return errors.New("files can't be empty.")
   }
 
   var files_json []string;
   err := json.Unmarshal([]byte(files), &files_json)
   if err != nil { 
-		fmt.Fprint(w, "files need to be a valid json array.")
-		return
+		return errors.New("files need to be a valid json array.")
   }
 
-	directory := repos_path + "/" + getRepoDir(url)
-	remote := r.PostFormValue("remote")
-	if len(remote) == 0 {
-		remote = "origin"
+	if repo.ScheduleHours < 0 {
+		return errors.New("schedule_hours must be positive")
 	}
 
-	repo := models.Repository{
-		Url:          url,
-		WatchedFiles: []byte(files),
-		Directory:    directory,
-		Remote:       remote,
+	err = schedule.Validate(repo.ScheduleCron, repo.Timezone)
+	if err != nil {
+		return err
 	}
 
-	err = database.DB.CreateRepository(repo)
+	// fails early on a missing secret instead of in the first pull
+	_, err = git_auth(repo)
 	if err != nil {
-		fmt.Fprint(w, err)
-		return
+		return err
 	}
 
-	go gitClone(url, directory)
-	fmt.Fprintf(w, "Repo created")
+	directory, err := repo_directory(repos_path, url)
+	if err != nil {
+		return err
+	}
+	repo.Directory = directory
+	if len(repo.Remote) == 0 {
+		repo.Remote = "origin"
+	}
+
+	if repo.ScheduleHours == 0 {
+		repo.ScheduleHours = DefaultScheduleHours
+	}
+
+	// due right away, the first pull clones it on the worker pool
+	repo.NextRunAt = time.Now()
+
+	err = database.DB.CreateRepository(repo)
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
 func UpdateRepo(w http.ResponseWriter, r *http.Request) {
@@ -89,6 +158,8 @@ func UpdateRepo(w http.ResponseWriter, r *http.Request) {
 	watchedFiles := r.PostFormValue("watched_files")
 	remote := r.PostFormValue("remote")
 	scheduleHoursRaw := r.PostFormValue("schedule_hours")
+	scheduleCron := r.PostFormValue("schedule_cron")
+	timezone := r.PostFormValue("timezone")
 	deletedRaw := r.PostFormValue("deleted")
 
 	if idRaw == "" || url == "" || directory == "" || watchedFiles == "" || remote == "" || scheduleHoursRaw == "" {
@@ -109,14 +180,32 @@ func UpdateRepo(w http.ResponseWriter, r *http.Request) {
   }
 
 	scheduleHours, err := strconv.Atoi(scheduleHoursRaw)
+	if err != nil || scheduleHours < 1 {
+		fmt.Fprint(w, "Invalid schedule_hours value")
+		return
+	}
+
+	id, err := strconv.Atoi(idRaw)
 	if err != nil {
 		fmt.Fprint(w, "Invalid id value")
 		return
 	}
 
-	id, err := strconv.Atoi(idRaw)
+	current, err := database.DB.GetRepositoryById(id)
 	if err != nil {
-		fmt.Fprint(w, "Invalid schedule_hours value")
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// the new schedule counts from the last run
+	from := time.Now()
+	if current.LastRunAt != nil {
+		from = *current.LastRunAt
+	}
+
+	nextRunAt, err := schedule.Next(scheduleHours, scheduleCron, timezone, from)
+	if err != nil {
+		fmt.Fprint(w, err)
 		return
 	}
 
@@ -136,6 +225,18 @@ func UpdateRepo(w http.ResponseWriter, r *http.Request) {
 		Remote:        remote,
 		ScheduleHours: scheduleHours,
 		Deleted:       deleted,
+		Tags:          r.PostFormValue("tags"),
+		NextRunAt:     nextRunAt,
+		ScheduleCron:  scheduleCron,
+		Timezone:      timezone,
+		AuthUsername:  r.PostFormValue("auth_username"),
+		AuthSecret:    r.PostFormValue("auth_secret"),
+	}
+
+	_, err = git_auth(repository)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
 	}
 
 	err = database.DB.UpdateRepository(id, repository)
@@ -1,69 +1,198 @@
 package repositories
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"monitor2/src/alerts"
 	database "monitor2/src/db"
 	"monitor2/src/db/models"
+	"monitor2/src/runs"
+	"monitor2/src/schedule"
+	"monitor2/src/secrets"
+	"monitor2/src/workers"
+	"monitor2/utils"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
-func RunBySchedule(schedule int, db *database.Database) (int, []error) {
+// DefaultScheduleHours is used when a repository is created.
+const DefaultScheduleHours = 24
+
+// RunDue pulls every repository whose next run is before now
+// and schedules its following run, see crawler.RunDue.
+func RunDue(ctx context.Context, now time.Time, lease time.Duration, limit int, db *database.Database) (int, []error) {
 	var errors []error
 
-	repositories, err := database.DB.GetManyRepositoriesBySchedule(schedule)
+	repositories, err := db.ClaimDueRepositories(now, now.Add(lease), limit)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
+		errors = append(errors, err)
 		return 0, errors
 	}
 
+	jobs := []workers.Job{}
 	for _, repository := range repositories {
-    diff, commit, err := gitPullAndDiff(repository, git.PullOptions{
-			RemoteName: repository.Remote,
-		})
-
+		next, err := schedule.Next(repository.ScheduleHours, repository.ScheduleCron, repository.Timezone, now)
 		if err != nil {
-			log.Err(err).Caller().Msg("")
-			continue
+			// keep running by interval until the cron expression is fixed
+			errors = append(errors, err)
+			report_failure(repository, alerts.Stage("schedule", err))
+			next, _ = schedule.Next(repository.ScheduleHours, "", "", now)
 		}
 
-		log.Info().
-			Caller().
-			Str("url", repository.Url).
-			Str("diff", diff).
-			Msg("Successfully pulled and diffed")
-
-		if len(diff) != 0 {
-			id := uuid.New().String()
-
-			err := db.CreateDiff(models.Diff{
-				Id:   id,
-				Body: diff,
-				Url:  repository.Url,
-        Commit: commit,
-			})
-
+		// set once the job starts, a failing repository waits for its next run too
+		id := repository.Id
+		job := repository_job(repository, db)
+		job.Start = func() error {
+			return db.SetRepositoryRun(id, time.Now(), next)
+		}
+		job.Skip = func() {
+			err := db.ReleaseRepository(id, now.Add(lease), time.Now())
 			if err != nil {
 				log.Err(err).Caller().Msg("")
-				continue
 			}
-
-			ngrok_url := os.Getenv("NGROK_URL")
-			msg := fmt.Sprintf("repo: %s\n%s/diff/%s", repository.Url, ngrok_url, id)
-			alerts.Alert(msg, "", "diff")
 		}
+		jobs = append(jobs, job)
+	}
+	workers.Default.Submit(ctx, jobs)
+
+	return len(repositories), errors
+}
+
+func repository_job(repository models.Repository, db *database.Database) workers.Job {
+	return workers.Job{
+		Host: workers.Host(repository.Url),
+		Run: func(ctx context.Context) error {
+			return errors.Join(run_repository(ctx, repository, db)...)
+		},
+	}
+}
+
+func run_repository(ctx context.Context, repository models.Repository, db *database.Database) []error {
+	var errors []error
+
+	err := RunSingle(ctx, repository, db)
+	if err != nil {
+		errors = append(errors, err)
+		repository.ConsecutiveFailures++
+		report_failure(repository, err)
+	} else {
+		repository.ConsecutiveFailures = 0
+	}
+
+	err = db.UpdateRepositoryFailures(repository.Id, repository.ConsecutiveFailures)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		errors = append(errors, err)
+		report_failure(repository, alerts.Stage("update", err))
+	}
+
+	return errors
+}
+
+// alert_target is the base event for alerts about repository, used for routing.
+func alert_target(repository models.Repository) alerts.Event {
+	return alerts.Event{
+		Source:   alerts.SourceRepository,
+		TargetId: repository.Id,
+		Tags:     utils.SplitList(repository.Tags),
+		Url:      repository.Url,
+	}
+}
+
+func report_failure(repository models.Repository, err error) {
+	err = alerts.Failure(alert_target(repository), err, repository.ConsecutiveFailures)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+}
+
+// RunSingle pulls repository once and records the run.
+func RunSingle(ctx context.Context, repository models.Repository, db *database.Database) error {
+	run := models.Run{
+		TargetType: alerts.TargetType(alerts.SourceRepository),
+		TargetId:   repository.Id,
+		Url:        repository.Url,
+		StartedAt:  time.Now(),
+	}
+
+	err := run_single(ctx, repository, db, &run)
+	runs.Record(db, run, err)
+	return err
+}
+
+func run_single(ctx context.Context, repository models.Repository, db *database.Database, run *models.Run) error {
+	auth, err := git_auth(repository)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return alerts.Stage("auth", err)
+	}
+
+	diff, old_commit, commit, err := gitPullAndDiff(ctx, repository, git.PullOptions{
+		RemoteName: repository.Remote,
+		Auth:       auth,
+	})
+
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return alerts.Stage("pull", err)
+	}
+	run.CommitRange = old_commit + ".." + commit
+
+	log.Info().
+		Caller().
+		Str("url", repository.Url).
+		Str("diff", diff).
+		Msg("Successfully pulled and diffed")
+
+	if len(diff) == 0 {
+		return nil
+	}
+	run.Diff = true
+	run.Lines = len(utils.SplitTerminator([]byte(diff), "\n"))
+
+	id := uuid.New().String()
+
+	err = db.CreateDiff(models.Diff{
+		Id:     id,
+		Body:   diff,
+		Url:    repository.Url,
+		Commit: commit,
+	})
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return alerts.Stage("store_diff", err)
+	}
+
+	ngrok_url := os.Getenv("NGROK_URL")
+	event := alert_target(repository)
+	event.Kind = alerts.KindDiff
+	event.Body = diff
+	event.DiffId = id
+	event.Link = fmt.Sprintf("%s/diff/%s", ngrok_url, id)
+
+	err = alerts.Alert(event)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+		return alerts.Stage("alert", err)
 	}
+	run.Alerted = true
 
-	return 0, errors
+	return nil
 }
 
 func getRepoDir(url string) string {
@@ -71,9 +200,48 @@ func getRepoDir(url string) string {
 	return tmp[len(tmp)-1]
 }
 
-func gitClone(url string, dir string) (*git.Repository, error) {
-	r, err := git.PlainClone(dir, false, &git.CloneOptions{
-		URL: url,
+// repo_directory is where url is cloned, a direct child of repos_path.
+func repo_directory(repos_path string, url string) (string, error) {
+	name := getRepoDir(url)
+	if name == "" || name == "." || name == ".." {
+		return "", errors.New("url has to end with the repository name")
+	}
+
+	directory := repos_path + "/" + name
+	if filepath.Dir(filepath.Clean(directory)) != filepath.Clean(repos_path) {
+		return "", errors.New("No path traversal pls")
+	}
+	return directory, nil
+}
+
+// git_auth returns the credentials of repository, nil for public ones.
+// https urls use basic auth with the secret as password/token,
+// other urls use it as a private ssh key checked against the known hosts.
+func git_auth(repository models.Repository) (transport.AuthMethod, error) {
+	if repository.AuthSecret == "" {
+		return nil, nil
+	}
+
+	secret, err := secrets.Get(repository.AuthSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	username := repository.AuthUsername
+	if username == "" {
+		username = "git"
+	}
+
+	if strings.HasPrefix(repository.Url, "https://") || strings.HasPrefix(repository.Url, "http://") {
+		return &githttp.BasicAuth{Username: username, Password: secret}, nil
+	}
+	return gitssh.NewPublicKeys(username, []byte(secret), "")
+}
+
+func gitClone(ctx context.Context, url string, dir string, auth transport.AuthMethod) (*git.Repository, error) {
+	r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:  url,
+		Auth: auth,
 	})
 
 	if err != nil {
@@ -83,14 +251,15 @@ func gitClone(url string, dir string) (*git.Repository, error) {
 	return r, nil
 }
 
-func gitPullAndDiff(repository models.Repository, pull_opts git.PullOptions) (string, string, error) {
+// gitPullAndDiff returns the diff of the watched files and the commits before and after the pull.
+func gitPullAndDiff(ctx context.Context, repository models.Repository, pull_opts git.PullOptions) (string, string, string, error) {
 	var watched_files []string
 	var repo *git.Repository
 
 	err := json.Unmarshal(repository.WatchedFiles, &watched_files)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 
 	log.Info().
@@ -102,56 +271,56 @@ func gitPullAndDiff(repository models.Repository, pull_opts git.PullOptions) (st
 	repo, err = git.PlainOpen(repository.Directory)
 	if err != nil {
 		if err.Error() == "repository does not exist" {
-			repo, err = gitClone(repository.Url, repository.Directory)
+			repo, err = gitClone(ctx, repository.Url, repository.Directory, pull_opts.Auth)
 
 			if err != nil {
 				log.Err(err).Caller().Msg("")
-				return "", "", err
+				return "", "", "", err
 			}
 		} else {
 			log.Err(err).Caller().Msg("")
-			return "", "", err
+			return "", "", "", err
 		}
 	}
 
 	old_head, err := repo.Head()
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 	old_head_commit, err := repo.CommitObject(old_head.Hash())
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 
 	w, err := repo.Worktree()
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
-	err = w.Pull(&pull_opts)
+	err = w.PullContext(ctx, &pull_opts)
 	if err != nil && err.Error() != "already up-to-date" {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 	ref, err := repo.Head()
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 	new_head_commit, err := repo.CommitObject(ref.Hash())
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 	patch, err := old_head_commit.Patch(new_head_commit)
 	if err != nil {
 		log.Err(err).Caller().Msg("")
-		return "", "", err
+		return "", "", "", err
 	}
 
-	return parse_diff(patch.String(), watched_files), new_head_commit.Hash.String(), nil
+	return parse_diff(patch.String(), watched_files), old_head_commit.Hash.String(), new_head_commit.Hash.String(), nil
 }
 
 func parse_diff(diff string, changed_files []string) string {
@@ -268,3 +268,16 @@ Hello, world! diff --git 1
 		t.Fail()
 	}
 }
+
+func TestRepoDirectory(t *testing.T) {
+	directory, err := repositories.RepoDirectory("/repos", "https://github.com/shafouz/monitor")
+	if err != nil || directory != "/repos/monitor" {
+		t.Fatal(directory, err)
+	}
+
+	for _, url := range []string{"https://github.com/shafouz/", "https://github.com/shafouz/.", "https://github.com/.."} {
+		if directory, err := repositories.RepoDirectory("/repos", url); err == nil {
+			t.Fatal(url, directory)
+		}
+	}
+}
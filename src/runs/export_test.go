@@ -0,0 +1,3 @@
+package runs
+
+var FilterFromQuery = filterFromQuery
@@ -0,0 +1,111 @@
+package runs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	database "monitor2/src/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	default_limit = 200
+	max_limit     = 1000
+)
+
+// Runs lists the recorded runs, as json with format=json.
+// Filters: target_type, target_id, url (substring), failed, diff,
+// since (a duration like 24h or an RFC3339 time) and limit.
+func Runs(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	runs, err := database.DB.GetRuns(filter)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(runs)
+		if err != nil {
+			fmt.Fprint(w, err)
+		}
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/runs.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "runs.html", map[string]any{
+		"Runs":  runs,
+		"Query": r.URL.Query(),
+	})
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+func filterFromQuery(query url.Values, now time.Time) (database.RunFilter, error) {
+	filter := database.RunFilter{
+		TargetType: query.Get("target_type"),
+		Url:        query.Get("url"),
+		Limit:      default_limit,
+	}
+
+	var err error
+	if raw := query.Get("target_id"); raw != "" {
+		filter.TargetId, err = strconv.Atoi(raw)
+		if err != nil {
+			return filter, errors.New("Invalid target_id value")
+		}
+	}
+
+	if raw := query.Get("failed"); raw != "" {
+		filter.FailedOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			return filter, errors.New("Invalid failed value")
+		}
+	}
+
+	if raw := query.Get("diff"); raw != "" {
+		filter.DiffOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			return filter, errors.New("Invalid diff value")
+		}
+	}
+
+	if raw := query.Get("since"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			filter.Since = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			filter.Since = t
+		} else {
+			return filter, errors.New("Invalid since value, use a duration like 24h or an RFC3339 time")
+		}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		filter.Limit, err = strconv.Atoi(raw)
+		if err != nil || filter.Limit < 1 {
+			return filter, errors.New("Invalid limit value")
+		}
+	}
+	if filter.Limit > max_limit {
+		filter.Limit = max_limit
+	}
+
+	return filter, nil
+}
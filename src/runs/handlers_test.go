@@ -0,0 +1,51 @@
+package runs_test
+
+import (
+	"monitor2/src/runs"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	query, _ := url.ParseQuery("target_type=endpoint&target_id=3&failed=true&since=24h&limit=5000")
+
+	filter, err := runs.FilterFromQuery(query, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filter.TargetType != "endpoint" || filter.TargetId != 3 || !filter.FailedOnly || filter.DiffOnly {
+		t.Fatal(filter)
+	}
+
+	if !filter.Since.Equal(now.Add(-24 * time.Hour)) {
+		t.Fatal(filter.Since)
+	}
+
+	if filter.Limit != 1000 {
+		t.Fatal(filter.Limit)
+	}
+}
+
+func TestFilterFromQueryDefaults(t *testing.T) {
+	filter, err := runs.FilterFromQuery(url.Values{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filter.Limit != 200 || !filter.Since.IsZero() {
+		t.Fatal(filter)
+	}
+}
+
+func TestFilterFromQueryRejectsBadValues(t *testing.T) {
+	for _, raw := range []string{"target_id=a", "failed=maybe", "since=yesterday", "limit=0"} {
+		query, _ := url.ParseQuery(raw)
+		_, err := runs.FilterFromQuery(query, time.Now())
+		if err == nil {
+			t.Fatal(raw)
+		}
+	}
+}
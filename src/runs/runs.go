@@ -0,0 +1,25 @@
+package runs
+
+import (
+	"monitor2/src/alerts"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Record stores run as finished now with the outcome of err.
+// Failing to store it is only logged, it doesn't fail the run.
+func Record(db *database.Database, run models.Run, err error) {
+	run.FinishedAt = time.Now()
+	run.DurationMs = int(run.FinishedAt.Sub(run.StartedAt).Milliseconds())
+	if err != nil {
+		run.Stage, run.Error = alerts.StageOf(err)
+	}
+
+	err = db.CreateRun(run)
+	if err != nil {
+		log.Err(err).Caller().Msg("")
+	}
+}
@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultPoll is how often the scheduler looks up due targets, SCHEDULER_POLL_SECONDS overrides it.
+const DefaultPoll = 60 * time.Second
+
+// Poll returns the scheduler poll interval.
+func Poll() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("SCHEDULER_POLL_SECONDS"))
+	if err != nil || seconds < 1 {
+		return DefaultPoll
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Parse parses a standard 5 field cron expression or a descriptor like @daily,
+// evaluated in the IANA timezone, empty means UTC.
+// The timezone can't be set in the expression and @every can't be shorter than the poll interval,
+// targets would run on every poll.
+func Parse(expr string, timezone string) (cron.Schedule, *time.Location, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	trimmed := strings.TrimSpace(expr)
+	if strings.HasPrefix(trimmed, "CRON_TZ=") || strings.HasPrefix(trimmed, "TZ=") {
+		return nil, nil, errors.New("invalid cron expression: use the timezone field instead of CRON_TZ/TZ")
+	}
+
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	if every, ok := sched.(cron.ConstantDelaySchedule); ok && every.Delay < Poll() {
+		return nil, nil, fmt.Errorf("invalid cron expression: @every has to be at least the poll interval of %s", Poll())
+	}
+
+	return sched, loc, nil
+}
+
+// Validate checks a cron expression and timezone coming from a form,
+// an empty expression means the target runs by interval.
+func Validate(expr string, timezone string) error {
+	if expr == "" {
+		if timezone != "" {
+			_, err := time.LoadLocation(timezone)
+			if err != nil {
+				return fmt.Errorf("invalid timezone: %w", err)
+			}
+		}
+		return nil
+	}
+
+	_, _, err := Parse(expr, timezone)
+	return err
+}
+
+// Next returns when a target that last ran at from has to run again.
+// A cron expression takes precedence over the interval of hours.
+func Next(hours int, expr string, timezone string, from time.Time) (time.Time, error) {
+	if expr == "" {
+		if hours < 1 {
+			hours = 1
+		}
+		return from.Add(time.Duration(hours) * time.Hour), nil
+	}
+
+	sched, loc, err := Parse(expr, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return sched.Next(from.In(loc)), nil
+}
+
+// Format shows t in the timezone of a target, falling back to UTC.
+func Format(t time.Time, timezone string) string {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format("2006-01-02 15:04 MST")
+}
@@ -0,0 +1,97 @@
+package schedule_test
+
+import (
+	"monitor2/src/schedule"
+	"testing"
+	"time"
+)
+
+func TestNextInterval(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	next, err := schedule.Next(12, "", "", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !next.Equal(from.Add(12 * time.Hour)) {
+		t.Fatal(next)
+	}
+}
+
+func TestNextRunsAtLeastHourly(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	next, err := schedule.Next(0, "", "", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !next.Equal(from.Add(time.Hour)) {
+		t.Fatal(next)
+	}
+}
+
+func TestNextCronInTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// friday 2024-01-05 10:00 in Berlin, the next weekday at 09:00 is monday
+	from := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	next, err := schedule.Next(8, "0 9 * * 1-5", "Europe/Berlin", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	correct := time.Date(2024, 1, 8, 9, 0, 0, 0, berlin)
+	if !next.Equal(correct) {
+		t.Fatal(next)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := schedule.Validate("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := schedule.Validate("@daily", "America/Sao_Paulo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := schedule.Validate("0 9 * *", ""); err == nil {
+		t.Fatal("expected error for 4 fields")
+	}
+
+	if err := schedule.Validate("0 9 * * *", "Mars/Olympus"); err == nil {
+		t.Fatal("expected error for unknown timezone")
+	}
+
+	if err := schedule.Validate("", "Mars/Olympus"); err == nil {
+		t.Fatal("expected error for unknown timezone")
+	}
+
+	if err := schedule.Validate("CRON_TZ=Asia/Tokyo 0 9 * * *", "Europe/Berlin"); err == nil {
+		t.Fatal("expected error for a timezone prefix")
+	}
+
+	if err := schedule.Validate("@every 1s", ""); err == nil {
+		t.Fatal("expected error for @every below the poll interval")
+	}
+
+	if err := schedule.Validate("@every 2h", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatInTimezone(t *testing.T) {
+	at := time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC)
+
+	if formatted := schedule.Format(at, "Europe/Berlin"); formatted != "2024-01-08 09:00 CET" {
+		t.Fatal(formatted)
+	}
+
+	if formatted := schedule.Format(at, ""); formatted != "2024-01-08 08:00 UTC" {
+		t.Fatal(formatted)
+	}
+}
@@ -0,0 +1,4 @@
+package schedule
+
+// embed the timezone database, the image may not ship one
+import _ "time/tzdata"
@@ -1,38 +1,84 @@
 package monitor2
 
 import (
+	"context"
 	"log"
+	"monitor2/src/alerts"
 	"monitor2/src/crawler"
-	"monitor2/src/repositories"
 	database "monitor2/src/db"
+	"monitor2/src/repositories"
+	"monitor2/src/schedule"
+	"monitor2/src/workers"
+	"os"
+	"strconv"
 	"time"
 )
 
-func make_schedule(duration int) time.Duration {
-	return time.Duration(duration) * time.Hour
-}
+// how long a claimed target stays with a replica before its job starts,
+// SCHEDULER_LEASE_SECONDS overrides it
+const default_lease = time.Hour
 
-func StartScheduler() {
-	// time.Duration(1) * time.Second
-	jobs := []int{
-    8,
-    24,
-    24*7,
+func seconds_from_env(env string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return fallback
 	}
 
-	for _, schedule := range jobs {
-		go run_at(crawler.RunBySchedule, schedule, "crawler", &database.DB)
-		go run_at(repositories.RunBySchedule, schedule, "repos", &database.DB)
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 1 {
+		log.Printf("Invalid %s: %s", env, raw)
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// StartScheduler runs every endpoint and repository when its next_run_at is due.
+// Run times are stored in the db so a restart keeps every timer.
+// Claimed jobs are submitted to the worker pool and the next poll doesn't wait for them,
+// it stops dispatching once ctx is done and returns after the running jobs finished,
+// cancelling jobs_ctx stops them.
+// Due targets are claimed in the db, so replicas never run the same target twice.
+func StartScheduler(ctx context.Context, jobs_ctx context.Context) {
+	// the interval @every schedules are validated against
+	poll := schedule.Poll()
+	lease := seconds_from_env("SCHEDULER_LEASE_SECONDS", default_lease)
+	log.Printf("Polling for due targets every %s", poll)
+
+	for ctx.Err() == nil {
+		now := time.Now()
+		// crawls and pulls together claim at most the idle workers, so claimed jobs
+		// start well within their lease and the other replicas take the rest
+		limit := workers.Default.Free()
+
+		// crawls and pulls share the worker pool
+		crawled := run_due(jobs_ctx, crawler.RunDue, now, lease, limit, "crawler", &database.DB)
+		run_due(jobs_ctx, repositories.RunDue, now, lease, limit-crawled, "repos", &database.DB)
+
+		// sends the digests of the jobs that finished since the last poll
+		err := alerts.Flush()
+		if err != nil {
+			log.Printf("Could not flush alerts: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(poll):
+		}
 	}
+
+	workers.Default.Wait()
 }
 
 type RowsAffected = int
-type Task func(duration int, DB *database.Database) (RowsAffected, []error)
+type Task func(ctx context.Context, now time.Time, lease time.Duration, limit int, DB *database.Database) (RowsAffected, []error)
 
-func run_at(fn Task, duration int, func_name string, DB *database.Database) {
-	for {
-    log.Printf("Running %+v, duration: %d\n", func_name, duration)
-		fn(duration, DB)
-		time.Sleep(make_schedule(duration))
+func run_due(ctx context.Context, fn Task, now time.Time, lease time.Duration, limit int, func_name string, DB *database.Database) RowsAffected {
+	if limit < 1 {
+		return 0
+	}
+	n, errors := fn(ctx, now, lease, limit, DB)
+	if n > 0 {
+		log.Printf("Started %+v on %d target(s), %d error(s)\n", func_name, n, len(errors))
 	}
+	return n
 }
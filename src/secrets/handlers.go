@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	database "monitor2/src/db"
+	"net/http"
+)
+
+// Secrets lists the secret names, values are never sent back.
+func Secrets(w http.ResponseWriter, r *http.Request) {
+	secrets, err := database.DB.GetAllSecrets()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/secrets.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "secrets.html", map[string]any{
+		"Secrets": secrets,
+		"Enabled": key != nil,
+	})
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+// sealFromForm validates name and encrypts value.
+func sealFromForm(r *http.Request) (string, []byte, error) {
+	name := r.PostFormValue("name")
+	value := r.PostFormValue("value")
+
+	err := ValidateName(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(value) == 0 {
+		return "", nil, errors.New("Missing 'value' param")
+	}
+
+	sealed, err := Encrypt([]byte(value))
+	if err != nil {
+		return "", nil, err
+	}
+	return name, sealed, nil
+}
+
+func CreateSecret(w http.ResponseWriter, r *http.Request) {
+	name, sealed, err := sealFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = database.DB.CreateSecret(name, sealed)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/secrets", 303)
+}
+
+// RotateSecret replaces the value of a secret, references keep working.
+func RotateSecret(w http.ResponseWriter, r *http.Request) {
+	name, sealed, err := sealFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	rows_affected, err := database.DB.RotateSecret(name, sealed)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if rows_affected == 0 {
+		fmt.Fprintf(w, "No secret called %s", name)
+		return
+	}
+
+	http.Redirect(w, r, "/secrets", 303)
+}
+
+func DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("name")
+	if len(name) == 0 {
+		fmt.Fprint(w, "Missing 'name' param")
+		return
+	}
+
+	rows_affected, err := database.DB.DeleteSecret(name)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Rows affected: %+v\n", rows_affected)
+}
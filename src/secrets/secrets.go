@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	database "monitor2/src/db"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoKey = errors.New("SECRETS_KEY is not set")
+
+// master key, secrets are sealed with AES-256-GCM
+var key []byte
+
+// Init reads the base64 encoded 32 byte SECRETS_KEY, e.g. from `openssl rand -base64 32`.
+// Without it secrets can't be stored or used.
+func Init() error {
+	raw := os.Getenv("SECRETS_KEY")
+	if raw == "" {
+		log.Warn().Msg("SECRETS_KEY is empty, secrets are disabled")
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return fmt.Errorf("SECRETS_KEY is not base64: %w", err)
+	}
+	return SetKey(decoded)
+}
+
+func SetKey(k []byte) error {
+	if len(k) != 32 {
+		return fmt.Errorf("SECRETS_KEY must be 32 bytes, got %d", len(k))
+	}
+	key = k
+	return nil
+}
+
+func aead() (cipher.AEAD, error) {
+	if key == nil {
+		return nil, ErrNoKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns the nonce followed by the sealed plain text.
+func Encrypt(plain []byte) ([]byte, error) {
+	gcm, err := aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func Decrypt(sealed []byte) ([]byte, error) {
+	gcm, err := aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed secret is too short")
+	}
+	nonce, text := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, text, nil)
+}
+
+var valid_name = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func ValidateName(name string) error {
+	if !valid_name.MatchString(name) {
+		return errors.New("Secret names can only contain letters, digits, _, . and -")
+	}
+	return nil
+}
+
+// Get decrypts the secret called name.
+func Get(name string) (string, error) {
+	secret, err := database.DB.GetSecret(name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+
+	plain, err := Decrypt(secret.Value)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// Store encrypts value into the secret called name, creating it or replacing its value.
+func Store(name string, value string) error {
+	err := ValidateName(name)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := Encrypt([]byte(value))
+	if err != nil {
+		return err
+	}
+
+	rows_affected, err := database.DB.RotateSecret(name, sealed)
+	if err != nil {
+		return err
+	}
+	if rows_affected > 0 {
+		return nil
+	}
+	return database.DB.CreateSecret(name, sealed)
+}
+
+// Reference returns the {{secret:NAME}} expanded to the secret called name.
+func Reference(name string) string {
+	return "{{secret:" + name + "}}"
+}
+
+// {{secret:NAME}}
+var reference = regexp.MustCompile(`\{\{\s*secret:([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Expand replaces every {{secret:NAME}} in s with the value of the secret.
+func Expand(s string) (string, error) {
+	return ExpandWith(s, Get)
+}
+
+func ExpandWith(s string, lookup func(name string) (string, error)) (string, error) {
+	var err error
+	ret := reference.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return ""
+		}
+
+		var value string
+		value, err = lookup(reference.FindStringSubmatch(match)[1])
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+// IsReference is true when s is only a {{secret:NAME}}, showing it leaks nothing.
+func IsReference(s string) bool {
+	loc := reference.FindStringIndex(strings.TrimSpace(s))
+	return loc != nil && loc[0] == 0 && loc[1] == len(strings.TrimSpace(s))
+}
+
+// HasReference is true when s uses at least one secret.
+func HasReference(s string) bool {
+	return reference.MatchString(s)
+}
+
+// headers whose name contains one of these carry credentials
+var sensitive_words = []string{"auth", "cookie", "token", "key", "secret", "session", "password"}
+
+func SensitiveHeader(name string) bool {
+	lower := strings.ToLower(name)
+	for _, word := range sensitive_words {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders returns a copy of headers safe to log.
+func RedactHeaders(headers http.Header) http.Header {
+	ret := http.Header{}
+	for name, values := range headers {
+		if SensitiveHeader(name) {
+			ret[name] = []string{"[redacted]"}
+			continue
+		}
+		ret[name] = values
+	}
+	return ret
+}
@@ -0,0 +1,109 @@
+package secrets_test
+
+import (
+	"bytes"
+	"errors"
+	"monitor2/src/secrets"
+	"net/http"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	if err := secrets.SetKey(bytes.Repeat([]byte("k"), 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := secrets.Encrypt([]byte("Bearer abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("Bearer abc")) {
+		t.Fatal("value stored in plain text")
+	}
+
+	again, err := secrets.Encrypt([]byte("Bearer abc"))
+	if err != nil || bytes.Equal(sealed, again) {
+		t.Fatal("nonce reused", err)
+	}
+
+	plain, err := secrets.Decrypt(sealed)
+	if err != nil || string(plain) != "Bearer abc" {
+		t.Fatal(string(plain), err)
+	}
+
+	// another master key can't open it
+	if err := secrets.SetKey(bytes.Repeat([]byte("x"), 32)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secrets.Decrypt(sealed); err == nil {
+		t.Fatal("decrypted with the wrong key")
+	}
+}
+
+func TestSetKeyLength(t *testing.T) {
+	if err := secrets.SetKey([]byte("short")); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestExpandWith(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "api_token" {
+			return "abc", nil
+		}
+		return "", errors.New("no secret " + name)
+	}
+
+	got, err := secrets.ExpandWith("Bearer {{secret:api_token}}", lookup)
+	if err != nil || got != "Bearer abc" {
+		t.Fatal(got, err)
+	}
+
+	got, err = secrets.ExpandWith("no references", lookup)
+	if err != nil || got != "no references" {
+		t.Fatal(got, err)
+	}
+
+	if _, err := secrets.ExpandWith("{{ secret:missing }}", lookup); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestIsReference(t *testing.T) {
+	if !secrets.IsReference("{{secret:api_token}}") {
+		t.Fatal()
+	}
+	if secrets.IsReference("Bearer {{secret:api_token}}") || secrets.IsReference("abc") {
+		t.Fatal()
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer abc"},
+		"Cookie":        {"session=s1"},
+		"X-Api-Key":     {"k1"},
+		"Accept":        {"*/*"},
+	}
+
+	redacted := secrets.RedactHeaders(headers)
+	for _, name := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+		if redacted.Get(name) != "[redacted]" {
+			t.Fatal(name, redacted.Get(name))
+		}
+	}
+	if redacted.Get("Accept") != "*/*" || headers.Get("Authorization") != "Bearer abc" {
+		t.Fatal(redacted, headers)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	if err := secrets.ValidateName("github.token-1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "with space", "{{x}}"} {
+		if err := secrets.ValidateName(name); err == nil {
+			t.Fatal(name)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package sessions
+
+import "monitor2/src/db/models"
+
+func SetLookup(fn func(name string) (models.Session, error)) {
+	lookup = fn
+}
+
+// SetStoreSecret replaces where SealSteps stores secrets, the returned func restores it.
+func SetStoreSecret(fn func(name string, value string) error) func() {
+	old := store_secret
+	store_secret = fn
+	return func() { store_secret = old }
+}
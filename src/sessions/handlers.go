@@ -0,0 +1,105 @@
+package sessions
+
+import (
+	"fmt"
+	"html/template"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"net/http"
+)
+
+func Sessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := database.DB.GetAllSessions()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	template, err := template.ParseFiles("static/templates/sessions.html")
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = template.ExecuteTemplate(w, "sessions.html", sessions)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+}
+
+func sessionFromForm(r *http.Request) (models.Session, error) {
+	session := models.Session{
+		Name:             r.PostFormValue("name"),
+		Steps:            []byte(r.PostFormValue("steps")),
+		LoggedOutPattern: r.PostFormValue("logged_out_pattern"),
+	}
+
+	err := Validate(session)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	// the Session row never holds passwords
+	_, err = SealSteps(&session)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+func CreateSession(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	err = database.DB.CreateSession(session)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions", 303)
+}
+
+func UpdateSession(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionFromForm(r)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	rows_affected, err := database.DB.UpdateSession(session)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if rows_affected == 0 {
+		fmt.Fprintf(w, "No session called %s", session.Name)
+		return
+	}
+
+	// the next crawl logs in with the new steps
+	Invalidate(session.Name)
+	http.Redirect(w, r, "/sessions", 303)
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("name")
+	if len(name) == 0 {
+		fmt.Fprint(w, "Missing 'name' param")
+		return
+	}
+
+	rows_affected, err := database.DB.DeleteSession(name)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+	Invalidate(name)
+
+	fmt.Fprintf(w, "Rows affected: %+v\n", rows_affected)
+}
@@ -0,0 +1,408 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	database "monitor2/src/db"
+	"monitor2/src/db/models"
+	"monitor2/src/secrets"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is one request of a login recipe.
+// Url, headers and body can use {{var:NAME}} from earlier steps and {{secret:NAME}},
+// secrets are expanded first so they can hold variables and extracted values can't name a secret.
+type Step struct {
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// variable name -> regexp run on the response body, its first group is stored,
+	// e.g. {"csrf": "name=\"csrf\" value=\"([^\"]+)\""}
+	Extract map[string]string `json:"extract,omitempty"`
+}
+
+// where an expired session usually redirects to: a /login, /signin or /auth path segment,
+// not /blog-index, /author or /oauth
+const default_logged_out_pattern = `(?i)(^|/)(log-?in|sign-?in|sign_in|auth)(\.\w+)?(/|$)`
+
+// limits of the login requests, the crawler passes its fetch settings to SetLimits
+var (
+	login_timeout  = 30 * time.Second
+	max_body_bytes = int64(10 << 20)
+	max_redirects  = 10
+)
+
+// SetLimits caps every login request at timeout, max_body bytes read and redirects.
+func SetLimits(timeout time.Duration, max_body int64, redirects int) {
+	login_timeout, max_body_bytes, max_redirects = timeout, max_body, redirects
+}
+
+func check_redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= max_redirects {
+		return fmt.Errorf("stopped after %d redirects", max_redirects)
+	}
+	return nil
+}
+
+// ParseSteps parses and validates the steps of a recipe.
+func ParseSteps(raw []byte) ([]Step, error) {
+	var steps []Step
+	err := json.Unmarshal(raw, &steps)
+	if err != nil {
+		return nil, fmt.Errorf("steps need to be a json array: %w", err)
+	}
+
+	if len(steps) == 0 {
+		return nil, errors.New("steps can't be empty")
+	}
+
+	for i, step := range steps {
+		if step.Url == "" {
+			return nil, fmt.Errorf("step %d: missing url", i+1)
+		}
+
+		for name, pattern := range step.Extract {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: extract %s: %w", i+1, name, err)
+			}
+			if re.NumSubexp() < 1 {
+				return nil, fmt.Errorf("step %d: extract %s needs a capture group", i+1, name)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// Validate checks a recipe before it is stored.
+func Validate(session models.Session) error {
+	if err := secrets.ValidateName(session.Name); err != nil {
+		return err
+	}
+
+	if _, err := ParseSteps(session.Steps); err != nil {
+		return err
+	}
+
+	_, err := regexp.Compile(session.LoggedOutPattern)
+	return err
+}
+
+var variable = regexp.MustCompile(`\{\{\s*var:([A-Za-z0-9_.-]+)\s*\}\}`)
+
+func expand(s string, vars map[string]string) (string, error) {
+	s, err := secrets.Expand(s)
+	if err != nil {
+		return "", err
+	}
+
+	s = variable.ReplaceAllStringFunc(s, func(match string) string {
+		name := variable.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("variable %s was not extracted", name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// store_secret seals a credential, replaced in tests
+var store_secret = secrets.Store
+
+// SealSteps moves the plain bodies and sensitive header values of the steps of session
+// into secrets called session.<name>.step<n>.body or .header.<name> and references them instead,
+// like crawler.SealCredentials does for endpoints. Values already using a secret are kept.
+// Returns whether anything was sealed.
+func SealSteps(session *models.Session) (bool, error) {
+	steps, err := ParseSteps(session.Steps)
+	if err != nil {
+		return false, err
+	}
+
+	sealed := false
+	for i := range steps {
+		prefix := fmt.Sprintf("session.%s.step%d", session.Name, i+1)
+
+		value, changed, err := seal(prefix+".body", steps[i].Body)
+		if err != nil {
+			return false, fmt.Errorf("step %d: body can't be stored as a secret: %w", i+1, err)
+		}
+		steps[i].Body = value
+		sealed = sealed || changed
+
+		for name, value := range steps[i].Headers {
+			if !secrets.SensitiveHeader(name) {
+				continue
+			}
+
+			value, changed, err := seal(prefix+".header."+secret_suffix(name), value)
+			if err != nil {
+				return false, fmt.Errorf("step %d: header %s can't be stored as a secret: %w", i+1, name, err)
+			}
+			steps[i].Headers[name] = value
+			sealed = sealed || changed
+		}
+	}
+
+	if !sealed {
+		return false, nil
+	}
+
+	session.Steps, err = json.MarshalIndent(steps, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// seal stores value as the secret called name and returns its reference,
+// values without plain text besides variables, or using a secret already, are kept.
+func seal(name string, value string) (string, bool, error) {
+	if secrets.HasReference(value) || strings.TrimSpace(variable.ReplaceAllString(value, "")) == "" {
+		return value, false, nil
+	}
+
+	err := store_secret(name, value)
+	if err != nil {
+		return "", false, err
+	}
+	return secrets.Reference(name), true, nil
+}
+
+var invalid_secret_chars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+func secret_suffix(name string) string {
+	return invalid_secret_chars.ReplaceAllString(strings.ToLower(name), "_")
+}
+
+// SealStoredSessions seals the steps of sessions saved before they were sealed on save.
+// It runs on startup, sql migrations can't encrypt.
+func SealStoredSessions(db *database.Database) error {
+	sessions, err := db.GetAllSessions()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		sealed, err := SealSteps(&session)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", session.Name, err))
+			continue
+		}
+		if !sealed {
+			continue
+		}
+
+		_, err = db.UpdateSession(session)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", session.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Login runs the steps of session in order and returns the cookies they set.
+func Login(ctx context.Context, session models.Session) (http.CookieJar, error) {
+	steps, err := ParseSteps(session.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Jar: jar, Timeout: login_timeout, CheckRedirect: check_redirect}
+
+	vars := map[string]string{}
+	for i, step := range steps {
+		err := run_step(ctx, client, step, vars)
+		if err != nil {
+			return nil, fmt.Errorf("login %s, step %d: %w", session.Name, i+1, err)
+		}
+	}
+	return jar, nil
+}
+
+func run_step(ctx context.Context, client *http.Client, step Step, vars map[string]string) error {
+	method := strings.ToUpper(step.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	url, err := expand(step.Url, vars)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if step.Body != "" {
+		expanded, err := expand(step.Body, vars)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(expanded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+
+	if step.Body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, value := range step.Headers {
+		value, err = expand(value, vars)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+
+	if len(step.Extract) == 0 {
+		return nil
+	}
+
+	response_body, err := io.ReadAll(io.LimitReader(response.Body, max_body_bytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(response_body)) > max_body_bytes {
+		return fmt.Errorf("response body is too large: more than %d bytes", max_body_bytes)
+	}
+
+	for name, pattern := range step.Extract {
+		match := regexp.MustCompile(pattern).FindSubmatch(response_body)
+		if match == nil {
+			return fmt.Errorf("extract %s: no match", name)
+		}
+		vars[name] = string(match[1])
+	}
+	return nil
+}
+
+// LoggedOut is true when response says the session expired:
+// a 401, or a redirect to a url whose path matches the logged out pattern of session.
+func LoggedOut(session models.Session, original_url string, response *http.Response) bool {
+	if response.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+
+	final_url := response.Request.URL.String()
+	if final_url == original_url {
+		return false
+	}
+
+	pattern := session.LoggedOutPattern
+	if pattern == "" {
+		pattern = default_logged_out_pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(response.Request.URL.Path)
+}
+
+type cached struct {
+	mu      sync.Mutex
+	session models.Session
+	jar     http.CookieJar
+}
+
+var cache = struct {
+	mu       sync.Mutex
+	sessions map[string]*cached
+}{sessions: map[string]*cached{}}
+
+// lookup loads a recipe, replaced in tests
+var lookup = func(name string) (models.Session, error) {
+	return database.DB.GetSession(name)
+}
+
+// Jar returns the cookies of the session called name, logging in
+// when there is no cached session yet.
+func Jar(ctx context.Context, name string) (http.CookieJar, models.Session, error) {
+	cache.mu.Lock()
+	entry, ok := cache.sessions[name]
+	if !ok {
+		entry = &cached{}
+		cache.sessions[name] = entry
+	}
+	cache.mu.Unlock()
+
+	// one login at a time per session, the others wait for its cookies
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.jar != nil {
+		return entry.jar, entry.session, nil
+	}
+
+	session, err := lookup(name)
+	if err != nil {
+		return nil, models.Session{}, fmt.Errorf("session %s: %w", name, err)
+	}
+
+	jar, err := Login(ctx, session)
+	if err != nil {
+		return nil, models.Session{}, err
+	}
+
+	entry.session = session
+	entry.jar = jar
+	return jar, session, nil
+}
+
+// Invalidate drops the cached cookies and recipe, the next Jar logs in again.
+func Invalidate(name string) {
+	expire(name, func(entry *cached) bool { return true })
+}
+
+// Expire drops the cached cookies when they are still jar, the ones that got logged out.
+// Endpoints sharing the session that see the same logout then log in once,
+// instead of ending each other's new sessions.
+func Expire(name string, jar http.CookieJar) {
+	expire(name, func(entry *cached) bool { return entry.jar == jar })
+}
+
+func expire(name string, stale func(entry *cached) bool) {
+	cache.mu.Lock()
+	entry, ok := cache.sessions[name]
+	cache.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// waits for a login in progress
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if stale(entry) {
+		entry.jar = nil
+	}
+}
@@ -0,0 +1,292 @@
+package sessions_test
+
+import (
+	"context"
+	"fmt"
+	"monitor2/src/db/models"
+	"monitor2/src/sessions"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a site with a csrf protected login form and a page behind it
+func loginServer(logins *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `<form><input name="csrf" value="tok123"></form>`)
+			return
+		}
+
+		if r.PostFormValue("csrf") != "tok123" || r.PostFormValue("password") != "hunter2" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		atomic.AddInt32(logins, 1)
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1", Path: "/"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "home")
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("sid"); err != nil || cookie.Value != "s1" {
+			http.Redirect(w, r, "/login?next=/dashboard", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "secret dashboard")
+	})
+	return httptest.NewServer(mux)
+}
+
+func recipe(base string, password string) models.Session {
+	return models.Session{
+		Name: "dashboard",
+		Steps: []byte(fmt.Sprintf(`[
+			{"url": "%[1]s/login", "extract": {"csrf": "name=\"csrf\" value=\"([^\"]+)\""}},
+			{"method": "POST", "url": "%[1]s/login", "body": "csrf={{var:csrf}}&password=%[2]s"}
+		]`, base, password)),
+	}
+}
+
+func TestLoginCollectsCookies(t *testing.T) {
+	var logins int32
+	server := loginServer(&logins)
+	defer server.Close()
+
+	jar, err := sessions.Login(context.Background(), recipe(server.URL, "hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(server.URL + "/dashboard")
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Value != "s1" {
+		t.Fatal(cookies)
+	}
+}
+
+func TestLoginFailsOnBadCredentials(t *testing.T) {
+	var logins int32
+	server := loginServer(&logins)
+	defer server.Close()
+
+	_, err := sessions.Login(context.Background(), recipe(server.URL, "wrong"))
+	if err == nil {
+		t.Fatal("expected the 403 to fail the login")
+	}
+}
+
+func TestJarIsCachedUntilInvalidated(t *testing.T) {
+	var logins int32
+	server := loginServer(&logins)
+	defer server.Close()
+
+	sessions.SetLookup(func(name string) (models.Session, error) {
+		return recipe(server.URL, "hunter2"), nil
+	})
+	sessions.Invalidate("dashboard")
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := sessions.Jar(context.Background(), "dashboard"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if logins != 1 {
+		t.Fatalf("logged in %d times", logins)
+	}
+
+	sessions.Invalidate("dashboard")
+	if _, _, err := sessions.Jar(context.Background(), "dashboard"); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 2 {
+		t.Fatalf("logged in %d times", logins)
+	}
+}
+
+func TestLoggedOut(t *testing.T) {
+	var logins int32
+	server := loginServer(&logins)
+	defer server.Close()
+
+	session := recipe(server.URL, "hunter2")
+	page := server.URL + "/dashboard"
+
+	// no cookies, redirected to the login page
+	response, err := http.Get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !sessions.LoggedOut(session, page, response) {
+		t.Fatal("login redirect not detected")
+	}
+
+	jar, err := sessions.Login(context.Background(), session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = (&http.Client{Jar: jar}).Get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if sessions.LoggedOut(session, page, response) {
+		t.Fatal("logged in session detected as logged out")
+	}
+}
+
+func TestParseSteps(t *testing.T) {
+	invalid := []string{
+		`{}`,
+		`[]`,
+		`[{"method": "GET"}]`,
+		`[{"url": "https://example.com", "extract": {"csrf": "no group"}}]`,
+		`[{"url": "https://example.com", "extract": {"csrf": "("}}]`,
+	}
+	for _, steps := range invalid {
+		if _, err := sessions.ParseSteps([]byte(steps)); err == nil {
+			t.Fatal(steps)
+		}
+	}
+}
+
+func TestExpireKeepsNewerLogins(t *testing.T) {
+	var logins int32
+	server := loginServer(&logins)
+	defer server.Close()
+
+	sessions.SetLookup(func(name string) (models.Session, error) {
+		return recipe(server.URL, "hunter2"), nil
+	})
+	sessions.Invalidate("dashboard")
+
+	stale, _, err := sessions.Jar(context.Background(), "dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first endpoint that saw the logout logs in again
+	sessions.Expire("dashboard", stale)
+	fresh, _, err := sessions.Jar(context.Background(), "dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sibling that saw the same logout keeps the new cookies
+	sessions.Expire("dashboard", stale)
+	jar, _, err := sessions.Jar(context.Background(), "dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jar != fresh || logins != 2 {
+		t.Fatalf("logged in %d times", logins)
+	}
+}
+
+func TestDefaultLoggedOutPattern(t *testing.T) {
+	redirect := func(target string) *http.Response {
+		u, _ := url.Parse(target)
+		return &http.Response{StatusCode: http.StatusOK, Request: &http.Request{URL: u}}
+	}
+
+	logged_out := []string{
+		"https://example.com/login?next=/admin",
+		"https://example.com/accounts/sign-in/",
+		"https://example.com/auth/realms/app",
+		"https://example.com/Login.php",
+	}
+	for _, target := range logged_out {
+		if !sessions.LoggedOut(models.Session{}, "https://example.com/admin", redirect(target)) {
+			t.Fatal(target)
+		}
+	}
+
+	logged_in := []string{
+		"https://example.com/blog-index",
+		"https://example.com/author/me",
+		"https://example.com/oauth/callback",
+		"https://login.example.com/admin",
+	}
+	for _, target := range logged_in {
+		if sessions.LoggedOut(models.Session{}, "https://example.com/admin", redirect(target)) {
+			t.Fatal(target)
+		}
+	}
+}
+
+func TestLoginLimits(t *testing.T) {
+	sessions.SetLimits(time.Second, 16, 2)
+	defer sessions.SetLimits(30*time.Second, 10<<20, 10)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("a", 64)+`value="tok"`)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, step := range []string{
+		`{"url": "` + server.URL + `/big", "extract": {"csrf": "value=\"([^\"]+)\""}}`,
+		`{"url": "` + server.URL + `/loop"}`,
+	} {
+		_, err := sessions.Login(context.Background(), models.Session{Name: "limits", Steps: []byte("[" + step + "]")})
+		if err == nil {
+			t.Fatalf("%s: not limited", step)
+		}
+	}
+}
+
+func TestSealSteps(t *testing.T) {
+	stored := map[string]string{}
+	defer sessions.SetStoreSecret(func(name string, value string) error {
+		stored[name] = value
+		return nil
+	})()
+
+	session := models.Session{
+		Name: "dashboard",
+		Steps: []byte(`[
+			{"url": "https://example.com/login", "headers": {"X-Csrf-Token": "{{var:csrf}}", "Accept": "text/html"}},
+			{"method": "POST", "url": "https://example.com/login", "headers": {"Authorization": "Basic dXNlcjpwdw=="},
+			 "body": "csrf={{var:csrf}}&password=hunter2"},
+			{"method": "POST", "url": "https://example.com/otp", "body": "code={{secret:otp}}"}
+		]`),
+	}
+
+	sealed, err := sessions.SealSteps(&session)
+	if err != nil || !sealed {
+		t.Fatal(sealed, err)
+	}
+
+	if strings.Contains(string(session.Steps), "hunter2") || strings.Contains(string(session.Steps), "dXNlcjpwdw==") {
+		t.Fatalf("%s", session.Steps)
+	}
+	if stored["session.dashboard.step2.body"] != "csrf={{var:csrf}}&password=hunter2" ||
+		stored["session.dashboard.step2.header.authorization"] != "Basic dXNlcjpwdw==" || len(stored) != 2 {
+		t.Fatal(stored)
+	}
+
+	steps, err := sessions.ParseSteps(session.Steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[0].Headers["X-Csrf-Token"] != "{{var:csrf}}" || steps[2].Body != "code={{secret:otp}}" {
+		t.Fatal(steps)
+	}
+
+	// sealing again changes nothing
+	sealed, err = sessions.SealSteps(&session)
+	if err != nil || sealed {
+		t.Fatal(sealed, err)
+	}
+}
@@ -0,0 +1,246 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a crawl or a pull, Host groups jobs for the per host limit.
+// Start, when set, runs once the job got its slots and before Run,
+// a job skipped on Close or because ctx is done calls Skip instead.
+type Job struct {
+	Host  string
+	Start func() error
+	Run   func(ctx context.Context) error
+	Skip  func()
+}
+
+// Pool runs jobs concurrently with at most `workers` at a time,
+// `per_host` of them against the same host, each one cancelled after `timeout`.
+type Pool struct {
+	workers  chan struct{}
+	per_host int
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+
+	closed chan struct{}
+	once   sync.Once
+
+	// jobs waiting for or holding a slot
+	busy atomic.Int64
+	// jobs started by Submit
+	submitted sync.WaitGroup
+}
+
+// ErrClosed is returned for jobs that hadn't started when the pool was closed.
+var ErrClosed = errors.New("worker pool closed")
+
+const (
+	DefaultWorkers = 4
+	DefaultPerHost = 2
+	DefaultTimeout = 5 * time.Minute
+)
+
+var Default = New(DefaultWorkers, DefaultPerHost, DefaultTimeout)
+
+// New returns a pool, per_host or timeout <= 0 disable that limit.
+func New(workers int, per_host int, timeout time.Duration) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Pool{
+		workers:  make(chan struct{}, workers),
+		per_host: per_host,
+		timeout:  timeout,
+		hosts:    map[string]chan struct{}{},
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close stops starting jobs, the ones already running keep going.
+func (p *Pool) Close() {
+	p.once.Do(func() { close(p.closed) })
+}
+
+// Init configures the default pool from WORKERS, WORKERS_PER_HOST and JOB_TIMEOUT_SECONDS.
+func Init() {
+	workers := intFromEnv("WORKERS", DefaultWorkers)
+	per_host := intFromEnv("WORKERS_PER_HOST", DefaultPerHost)
+	timeout := time.Duration(intFromEnv("JOB_TIMEOUT_SECONDS", int(DefaultTimeout/time.Second))) * time.Second
+
+	Default = New(workers, per_host, timeout)
+}
+
+func intFromEnv(env string, fallback int) int {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid %s: %s", env, raw)
+		return fallback
+	}
+	return n
+}
+
+// Free returns how many workers are idle right now,
+// jobs still waiting for a slot count as busy.
+func (p *Pool) Free() int {
+	free := cap(p.workers) - int(p.busy.Load())
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// Host returns the host of a target url, used as Job.Host.
+func Host(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return raw
+	}
+	return u.Hostname()
+}
+
+// Run runs every job and waits for all of them.
+// Jobs still waiting for a slot when ctx is done don't run and return its error.
+func (p *Pool) Run(ctx context.Context, jobs []Job) []error {
+	errs := make([]error, len(jobs))
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job Job) {
+			defer wg.Done()
+			errs[i] = p.run(ctx, job)
+		}(i, job)
+	}
+	wg.Wait()
+
+	ret := []error{}
+	for _, err := range errs {
+		if err != nil {
+			ret = append(ret, err)
+		}
+	}
+	return ret
+}
+
+// Do runs a single job within the pool limits and waits for it.
+func (p *Pool) Do(ctx context.Context, job Job) error {
+	return p.run(ctx, job)
+}
+
+// Submit starts every job without waiting for them, failed jobs are logged.
+// Wait returns once they finished.
+func (p *Pool) Submit(ctx context.Context, jobs []Job) {
+	for _, job := range jobs {
+		p.submitted.Add(1)
+		// counted before returning so the next Free sees it
+		p.busy.Add(1)
+		go func(job Job) {
+			defer p.submitted.Done()
+			defer p.busy.Add(-1)
+			err := p.start(ctx, job)
+			if err != nil && !errors.Is(err, ErrClosed) {
+				log.Printf("Job on %s failed: %+v", job.Host, err)
+			}
+		}(job)
+	}
+}
+
+// Wait waits for every job started by Submit.
+func (p *Pool) Wait() {
+	p.submitted.Wait()
+}
+
+func (p *Pool) run(ctx context.Context, job Job) error {
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+	return p.start(ctx, job)
+}
+
+func (p *Pool) start(ctx context.Context, job Job) error {
+	// take the host slot first so a job waiting on a busy host
+	// doesn't hold a worker other hosts could use
+	if host := p.host(job.Host); host != nil {
+		select {
+		case host <- struct{}{}:
+			defer func() { <-host }()
+		case <-p.closed:
+			return skip(job, ErrClosed)
+		case <-ctx.Done():
+			return skip(job, ctx.Err())
+		}
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		defer func() { <-p.workers }()
+	case <-p.closed:
+		return skip(job, ErrClosed)
+	case <-ctx.Done():
+		return skip(job, ctx.Err())
+	}
+
+	// both slots may be free when it closes
+	select {
+	case <-p.closed:
+		return skip(job, ErrClosed)
+	default:
+	}
+
+	if job.Start != nil {
+		err := job.Start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	err := job.Run(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.Join(err, errors.New("job timed out after "+p.timeout.String()))
+	}
+	return err
+}
+
+func skip(job Job, err error) error {
+	if job.Skip != nil {
+		job.Skip()
+	}
+	return err
+}
+
+func (p *Pool) host(name string) chan struct{} {
+	if p.per_host <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sem, ok := p.hosts[name]
+	if !ok {
+		sem = make(chan struct{}, p.per_host)
+		p.hosts[name] = sem
+	}
+	return sem
+}
@@ -0,0 +1,198 @@
+package workers_test
+
+import (
+	"context"
+	"errors"
+	"monitor2/src/workers"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tracker records the highest number of jobs running at once, per host and overall.
+type tracker struct {
+	mu      sync.Mutex
+	running map[string]int
+	total   int
+	max     map[string]int
+	max_all int
+}
+
+func newTracker() *tracker {
+	return &tracker{running: map[string]int{}, max: map[string]int{}}
+}
+
+func (tr *tracker) job(host string) workers.Job {
+	return workers.Job{
+		Host: host,
+		Run: func(ctx context.Context) error {
+			tr.mu.Lock()
+			tr.running[host]++
+			tr.total++
+			if tr.running[host] > tr.max[host] {
+				tr.max[host] = tr.running[host]
+			}
+			if tr.total > tr.max_all {
+				tr.max_all = tr.total
+			}
+			tr.mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			tr.mu.Lock()
+			tr.running[host]--
+			tr.total--
+			tr.mu.Unlock()
+			return nil
+		},
+	}
+}
+
+func TestPoolLimits(t *testing.T) {
+	pool := workers.New(3, 1, time.Second)
+	tr := newTracker()
+
+	jobs := []workers.Job{}
+	for _, host := range []string{"a", "a", "a", "b", "b", "c", "d", "e"} {
+		jobs = append(jobs, tr.job(host))
+	}
+
+	errs := pool.Run(context.Background(), jobs)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if tr.max_all > 3 {
+		t.Fatalf("%d jobs ran at once", tr.max_all)
+	}
+
+	for host, n := range tr.max {
+		if n > 1 {
+			t.Fatalf("%d jobs ran at once against %s", n, host)
+		}
+	}
+}
+
+func TestPoolCollectsErrors(t *testing.T) {
+	pool := workers.New(2, 0, 0)
+
+	jobs := []workers.Job{
+		{Host: "a", Run: func(ctx context.Context) error { return errors.New("boom") }},
+		{Host: "b", Run: func(ctx context.Context) error { return nil }},
+	}
+
+	errs := pool.Run(context.Background(), jobs)
+	if len(errs) != 1 || errs[0].Error() != "boom" {
+		t.Fatal(errs)
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	pool := workers.New(1, 0, 10*time.Millisecond)
+
+	jobs := []workers.Job{
+		{Host: "a", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+
+	errs := pool.Run(context.Background(), jobs)
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatal(errs)
+	}
+}
+
+func TestHost(t *testing.T) {
+	if host := workers.Host("https://github.com/shafouz/monitor"); host != "github.com" {
+		t.Fatal(host)
+	}
+
+	if host := workers.Host("not a url"); host != "not a url" {
+		t.Fatal(host)
+	}
+}
+
+func TestPoolCloseSkipsQueuedJobs(t *testing.T) {
+	pool := workers.New(1, 0, 0)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ran := false
+
+	jobs := []workers.Job{
+		{Host: "a", Run: func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}},
+	}
+
+	done := make(chan []error)
+	go func() { done <- pool.Run(context.Background(), jobs) }()
+	<-started
+
+	queued := make(chan error)
+	go func() {
+		queued <- pool.Do(context.Background(), workers.Job{
+			Host:  "b",
+			Start: func() error { ran = true; return nil },
+			Run:   func(ctx context.Context) error { ran = true; return nil },
+		})
+	}()
+
+	pool.Close()
+	if err := <-queued; !errors.Is(err, workers.ErrClosed) || ran {
+		t.Fatal(err)
+	}
+
+	// the running job finishes normally
+	close(release)
+	if errs := <-done; len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestPoolSkippedJobsCallSkip(t *testing.T) {
+	pool := workers.New(1, 0, 0)
+	pool.Close()
+
+	skipped := false
+	err := pool.Do(context.Background(), workers.Job{
+		Host:  "a",
+		Start: func() error { t.Fatal("started"); return nil },
+		Run:   func(ctx context.Context) error { return nil },
+		Skip:  func() { skipped = true },
+	})
+	if !errors.Is(err, workers.ErrClosed) || !skipped {
+		t.Fatal(err, skipped)
+	}
+
+	if free := pool.Free(); free != 1 {
+		t.Fatal(free)
+	}
+}
+
+func TestPoolSubmitDoesntWait(t *testing.T) {
+	pool := workers.New(2, 1, 0)
+
+	release := make(chan struct{})
+	job := workers.Job{Host: "a", Run: func(ctx context.Context) error {
+		<-release
+		return nil
+	}}
+
+	// returns while both jobs run or wait for the host
+	pool.Submit(context.Background(), []workers.Job{job, job})
+
+	// the job waiting for the host counts as busy
+	if free := pool.Free(); free != 0 {
+		t.Fatal(free)
+	}
+
+	close(release)
+	pool.Wait()
+	if free := pool.Free(); free != 2 {
+		t.Fatal(free)
+	}
+}
@@ -2,12 +2,8 @@ package utils
 
 import (
 	"bytes"
-	"errors"
-
-	// "fmt"
-	"os/exec"
-	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
@@ -23,6 +19,18 @@ func SplitTerminator(arr []byte, term string) [][]byte {
   return bytes.Split(trimmed, []byte(term))
 }
 
+// splits a comma separated list, dropping empty items
+func SplitList(s string) []string {
+  ret := []string{}
+  for _, item := range strings.Split(s, ",") {
+    item = strings.TrimSpace(item)
+    if len(item) != 0 {
+      ret = append(ret, item)
+    }
+  }
+  return ret
+}
+
 func CompactBytes(arr [][]byte) [][]byte {
   return slices.CompactFunc(arr, func(a []byte, b []byte) bool {
     if bytes.Compare(a, b) == 0 {
@@ -37,30 +45,3 @@ func SortBytes(arr [][]byte){
     return bytes.Compare(a, b)
   })
 }
-
-func RunPyScript(abs_path string, _stdin []byte, extra_args []string) ([]byte, error) {
-	if !filepath.IsAbs(abs_path) {
-		return nil, errors.New("Path not absolute.")
-	}
-
-	var outb, errb bytes.Buffer
-
-  args := []string{
-    abs_path,
-    // fmt.Sprint(len(_stdin)),
-  }
-  args = append(args, extra_args...)
-
-  log.Printf("python3 %+v\n", args)
-	cmd := exec.Command("python3", args...)
-	cmd.Stderr = &errb
-	cmd.Stdout = &outb
-  cmd.Stdin = bytes.NewReader(_stdin)
-
-	cmd.Run()
-  if errb.Len() != 0 {
-    return nil, errors.New(errb.String())
-  }
-
-  return outb.Bytes(), nil
-}
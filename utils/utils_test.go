@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"html/template"
 	"monitor2/utils"
-	"os"
 	"testing"
 
 	"github.com/rs/zerolog/log"
@@ -33,20 +32,6 @@ func TestDiffEmpty(t *testing.T) {
 	}
 }
 
-func TestRunScript(t *testing.T) {
-	os.WriteFile("/tmp/tmp123.py", []byte(`import sys
-req = sys.stdin.read()
-print(req)`), 0755)
-	b, err := utils.RunPyScript("/tmp/tmp123.py", []byte("hello"), []string{})
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if bytes.Compare(b, []byte("hello\n")) != 0 {
-		t.Fatal(err)
-	}
-}
-
 func TestSortBytes(t *testing.T) {
 	arr := [][]byte{
 		[]byte("zAbcedf"),